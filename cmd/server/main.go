@@ -1,42 +1,211 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"tagesTest/internal/config"
+	"tagesTest/internal/delivery/certs"
 	"tagesTest/internal/delivery/grpc"
+	"tagesTest/internal/delivery/http"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/events"
+	"tagesTest/internal/logger"
+	"tagesTest/internal/metadata"
 	"tagesTest/internal/repository"
 	"tagesTest/internal/service"
+	"tagesTest/internal/sharelink"
 	"tagesTest/internal/storage"
+	"tagesTest/internal/webhook"
 )
 
+const configWatchInterval = 2 * time.Second
+
 func main() {
-	cfg := config.Load()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	logLevel := new(slog.LevelVar)
+	level, err := logger.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("failed to create logger: %v", err)
+	}
+	logLevel.Set(level)
+	appLogger, err := logger.New(os.Stderr, logLevel, cfg.LogFormat)
+	if err != nil {
+		log.Fatalf("failed to create logger: %v", err)
+	}
+	slog.SetDefault(appLogger)
+	appLogger.Info("configuration loaded", slog.String("config", cfg.String()))
+
+	diskStorage := storage.NewDiskStorage(cfg.StorageDir)
+	if err := diskStorage.RemovePartialUploads(); err != nil {
+		appLogger.Warn("failed to remove partial uploads", slog.Any("error", err))
+	}
+	var fileStorage storage.FileStorageInterface = diskStorage
+	if cfg.Lifecycle.ColdStorageDir != "" {
+		coldStorage := storage.NewDiskStorage(cfg.Lifecycle.ColdStorageDir)
+		if err := coldStorage.RemovePartialUploads(); err != nil {
+			appLogger.Warn("failed to remove partial uploads", slog.Any("error", err))
+		}
+		fileStorage = storage.NewTieredStorage(diskStorage, coldStorage)
+	}
+	metadataStore, err := metadata.Open(cfg.MetadataFile)
+	if err != nil {
+		appLogger.Error("failed to open metadata store", slog.Any("error", err))
+		os.Exit(1)
+	}
+	eventBus := events.NewBus(cfg.Events.HistorySize, cfg.Events.MaxWatchers)
+	fileRepo := repository.NewFileRepository(fileStorage, metadataStore, eventBus)
+
+	shareSecret := []byte(cfg.ShareLinks.Secret)
+	if len(shareSecret) == 0 {
+		if shareSecret, err = fileRepo.ShareSecret(); err != nil {
+			appLogger.Error("failed to load share link secret", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+	fileService := service.NewFileService(fileRepo, sharelink.NewSigner(shareSecret))
+	buckets, err := service.NewBuckets(
+		fileService, repository.NewBucketLayout(fileRepo, cfg.StorageDir, cfg.Lifecycle.ColdStorageDir),
+	)
+	if err != nil {
+		appLogger.Error("failed to open buckets", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	webhooks, err := webhook.NewDispatcher(cfg.Webhooks, fileService, appLogger)
+	if err != nil {
+		appLogger.Error("failed to load webhook queues", slog.Any("error", err))
+		os.Exit(1)
+	}
+	webhooks.Start()
+
+	janitor := service.NewTrashJanitor(buckets, cfg.Trash.JanitorInterval, appLogger)
+	janitor.Start()
 
-	fileStorage := storage.NewDiskStorage(cfg.StorageDir)
-	fileRepo := repository.NewFileRepository(fileStorage)
-	fileService := service.NewFileService(fileRepo)
+	pol := policy.New(cfg)
+	lifecycle := service.NewLifecycleScheduler(buckets, cfg.Lifecycle.Interval, pol.LifecycleRules, appLogger)
+	lifecycle.Start()
 
-	server, err := grpc.NewServer(cfg.ServerAddress, fileService, cfg.StorageDir)
+	var reloader *certs.Reloader
+	if cfg.TLS.Enabled() {
+		if reloader, err = certs.NewReloader(cfg.TLS); err != nil {
+			appLogger.Error("failed to load TLS certificates", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
+	server, err := grpc.NewServer(cfg, buckets, pol, webhooks, reloader, appLogger)
 	if err != nil {
-		log.Fatalf("failed to create server: %v", err)
+		appLogger.Error("failed to create server", slog.Any("error", err))
+		os.Exit(1)
 	}
 
 	go func() {
-		log.Printf("Starting gRPC server on %s", cfg.ServerAddress)
+		appLogger.Info("starting gRPC server", slog.String("address", cfg.ServerAddress))
 		if err := server.Start(); err != nil {
-			log.Fatalf("failed to start server: %v", err)
+			appLogger.Error("failed to start server", slog.Any("error", err))
+			os.Exit(1)
 		}
 	}()
 
+	var httpServer *http.Server
+	if cfg.HTTPAddress != "" {
+		httpServer, err = http.NewServer(cfg, buckets, pol, webhooks, reloader, appLogger)
+		if err != nil {
+			appLogger.Error("failed to create HTTP server", slog.Any("error", err))
+			os.Exit(1)
+		}
+		go func() {
+			appLogger.Info("starting HTTP server", slog.String("address", cfg.HTTPAddress))
+			if err := httpServer.Start(); err != nil {
+				appLogger.Error("failed to start HTTP server", slog.Any("error", err))
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// reload applies a new configuration only if every part of it can be
+	// applied, otherwise the current one stays in effect
+	reload := func() {
+		newCfg, err := config.Load(os.Args[1:])
+		if err == nil {
+			err = config.CheckReloadable(cfg, newCfg)
+		}
+		var level slog.Level
+		if err == nil {
+			level, err = logger.ParseLevel(newCfg.LogLevel)
+		}
+		if err == nil && reloader != nil {
+			err = reloader.Reload(newCfg.TLS)
+		}
+		if err != nil {
+			appLogger.Error("config reload rejected", slog.Any("error", err))
+			return
+		}
+
+		pol.Reload(newCfg)
+		logLevel.Set(level)
+		cfg = newCfg
+		appLogger.Info("configuration reloaded", slog.String("config", cfg.String()))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var configChanges <-chan struct{}
+	if cfg.File != "" {
+		configChanges = config.Watch(ctx, cfg.File, configWatchInterval)
+	}
+
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	log.Println("Shutting down server...")
-	server.Stop()
-	log.Println("Server stopped")
+	for running := true; running; {
+		select {
+		case sig := <-quit:
+			if sig == syscall.SIGHUP {
+				appLogger.Info("received SIGHUP, reloading configuration")
+				reload()
+				continue
+			}
+			running = false
+		case <-configChanges:
+			appLogger.Info("config file changed, reloading configuration", slog.String("file", cfg.File))
+			reload()
+		}
+	}
+
+	appLogger.Info("shutting down server")
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer stopCancel()
+
+	var wg sync.WaitGroup
+	stop := func(name string, stopFn func(context.Context) error) {
+		defer wg.Done()
+		if err := stopFn(stopCtx); err != nil {
+			appLogger.Warn(name+" stopped forcefully", slog.Any("error", err))
+		}
+	}
+	wg.Add(1)
+	go stop("gRPC server", server.Stop)
+	if httpServer != nil {
+		wg.Add(1)
+		go stop("HTTP server", httpServer.Stop)
+	}
+	wg.Wait()
+	lifecycle.Stop()
+	janitor.Stop()
+	webhooks.Stop()
+	eventBus.Close()
+	appLogger.Info("server stopped")
 }
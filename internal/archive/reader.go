@@ -0,0 +1,203 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	ErrInvalid        = errors.New("invalid archive")
+	ErrUnsafePath     = errors.New("unsafe path")
+	ErrNotRegular     = errors.New("not a regular file")
+	ErrTooManyEntries = errors.New("too many archive entries")
+	ErrTooLarge       = errors.New("archive expands beyond the allowed size")
+)
+
+// Limits protect extraction against archive bombs. Zero means unlimited.
+type Limits struct {
+	MaxEntries   int
+	MaxTotalSize int64
+}
+
+// Entry is a single archive member. Body is nil when Err is set.
+type Entry struct {
+	Name string
+	Body io.Reader
+	// Err tells why the entry cannot be extracted.
+	Err error
+}
+
+// Walk calls fn for every file of the ZIP, tar or tar.gz archive read from r,
+// detecting the format from its first bytes. ZIP archives keep their index at
+// the end, so they are spooled to a temporary file in tmpDir first. Walk stops
+// with ErrTooManyEntries or ErrTooLarge once limits are exceeded.
+func Walk(r io.Reader, tmpDir string, limits Limits, fn func(Entry) error) error {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	w := &walker{limits: limits, fn: fn}
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return w.zip(br, tmpDir)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		defer gz.Close()
+		return w.tar(gz)
+	default:
+		return w.tar(br)
+	}
+}
+
+type walker struct {
+	limits  Limits
+	fn      func(Entry) error
+	entries int
+	total   int64
+}
+
+func (w *walker) zip(r io.Reader, tmpDir string) error {
+	spool, err := os.CreateTemp(tmpDir, "upload-*.zip")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	size, err := io.Copy(spool, r)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(spool, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	// the index lets a bomb be rejected before anything is extracted
+	precheck := &walker{limits: w.limits}
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			if err := precheck.count(int64(f.UncompressedSize64)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			if err := w.reject(f.Name, ErrNotRegular); err != nil {
+				return err
+			}
+			continue
+		}
+		// the zip reader fails on entries longer than declared, so declared
+		// sizes are safe to check up front
+		if err := w.count(int64(f.UncompressedSize64)); err != nil {
+			return err
+		}
+		if err := w.zipEntry(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) zipEntry(f *zip.File) error {
+	name, err := safeName(f.Name)
+	if err != nil {
+		return w.fn(Entry{Name: f.Name, Err: err})
+	}
+	body, err := f.Open()
+	if err != nil {
+		return w.fn(Entry{Name: name, Err: err})
+	}
+	defer body.Close()
+	return w.fn(Entry{Name: name, Body: body})
+}
+
+func (w *walker) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeReg:
+		default:
+			if err := w.reject(hdr.Name, ErrNotRegular); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.count(hdr.Size); err != nil {
+			return err
+		}
+		name, err := safeName(hdr.Name)
+		if err != nil {
+			if err := w.fn(Entry{Name: hdr.Name, Err: err}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.fn(Entry{Name: name, Body: tr}); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *walker) reject(name string, reason error) error {
+	if err := w.count(0); err != nil {
+		return err
+	}
+	return w.fn(Entry{Name: name, Err: reason})
+}
+
+func (w *walker) count(size int64) error {
+	w.entries++
+	w.total += size
+	if w.limits.MaxEntries > 0 && w.entries > w.limits.MaxEntries {
+		return fmt.Errorf("%w, max %d", ErrTooManyEntries, w.limits.MaxEntries)
+	}
+	if w.limits.MaxTotalSize > 0 && w.total > w.limits.MaxTotalSize {
+		return fmt.Errorf("%w of %d bytes", ErrTooLarge, w.limits.MaxTotalSize)
+	}
+	return nil
+}
+
+// safeName rejects entry names that would land outside the extraction root
+// (zip-slip) and returns the cleaned name.
+func safeName(name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if slashed == "" || path.IsAbs(slashed) || (len(slashed) > 1 && slashed[1] == ':') {
+		return "", ErrUnsafePath
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", ErrUnsafePath
+		}
+	}
+	return path.Clean(slashed), nil
+}
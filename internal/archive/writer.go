@@ -0,0 +1,114 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Format is the container format of an archive.
+type Format int
+
+const (
+	Zip Format = iota
+	TarGz
+)
+
+// ManifestName is the entry describing what the archive contains and which
+// requested files could not be added.
+const ManifestName = "MANIFEST.json"
+
+var ErrUnknownFormat = errors.New("unknown archive format")
+
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "zip":
+		return Zip, nil
+	case "tar.gz", "tgz":
+		return TarGz, nil
+	default:
+		return 0, fmt.Errorf("%w %q, expected zip or tar.gz", ErrUnknownFormat, s)
+	}
+}
+
+func (f Format) Extension() string {
+	if f == TarGz {
+		return ".tar.gz"
+	}
+	return ".zip"
+}
+
+func (f Format) ContentType() string {
+	if f == TarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// Writer adds files to an archive written sequentially to an io.Writer, so
+// the archive is never staged anywhere.
+type Writer interface {
+	Add(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+func NewWriter(format Format, w io.Writer) Writer {
+	if format == TarGz {
+		gz := gzip.NewWriter(w)
+		return &tarWriter{gz: gz, tw: tar.NewWriter(gz)}
+	}
+	return &zipWriter{zw: zip.NewWriter(w)}
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipWriter) Add(name string, size int64, modTime time.Time, r io.Reader) error {
+	// images are already compressed, storing them saves CPU for nothing lost
+	entry, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, r)
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+type tarWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (w *tarWriter) Add(name string, size int64, modTime time.Time, r io.Reader) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w.tw, io.LimitReader(r, size))
+	if err == nil && n != size {
+		err = fmt.Errorf("%s: %w", name, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+func (w *tarWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
@@ -1,39 +1,519 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
 	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 const (
-	defaultServerAddress = ":50051"
-	defaultStorageDir    = "./files_storage"
+	defaultServerAddress    = ":50051"
+	defaultHTTPAddress      = ":8080"
+	defaultHeaderTimeout    = 10 * time.Second
+	defaultStorageDir       = "./files_storage"
+	defaultLogLevel         = "info"
+	defaultLogFormat        = "text"
+	defaultUploadTimeout    = 30 * time.Second
+	defaultChunkSize        = 1024
+	defaultUploadBufferSize = 100
+	defaultShutdownTimeout  = 30 * time.Second
+	defaultDrainDelay       = 5 * time.Second
+	defaultHealthInterval   = 10 * time.Second
+	defaultMetadataFile     = "./files_metadata.json"
+	defaultShareLinkTTL     = 24 * time.Hour
+	defaultShareLinkMaxTTL  = 7 * 24 * time.Hour
+	defaultArchiveMaxSize   = 512 << 20
+	defaultArchiveEntries   = 1000
+	defaultArchiveTotalSize = 1 << 30
+	defaultEventHistory     = 1000
+	defaultMaxWatchers      = 100
+	defaultWebhookSpoolDir  = "./webhooks_spool"
+	defaultWebhookTimeout   = 10 * time.Second
+	defaultWebhookAttempts  = 10
+	defaultWebhookBackoff   = time.Second
+	defaultWebhookMaxWait   = 10 * time.Minute
+	defaultWebhookPending   = 10000
+	defaultMaxVersions      = 10
+	defaultTrashRetention   = 30 * 24 * time.Hour
+	defaultJanitorInterval  = time.Hour
+	defaultLifecycleRun     = time.Hour
+
+	// maxChunkSize keeps a single message below the default gRPC 4MB limit.
+	maxChunkSize = 4*1024*1024 - 1024
 )
 
+// Limits caps the number of concurrent calls per RPC across all clients.
+// Metadata covers calls that change only metadata, like share links and
+// tags, so they do not compete with uploads for slots.
+type Limits struct {
+	Upload   int `yaml:"upload"`
+	Download int `yaml:"download"`
+	List     int `yaml:"list"`
+	Metadata int `yaml:"metadata"`
+}
+
+// RPCLimit is the per-client budget for a single RPC.
+type RPCLimit struct {
+	Rate          float64 `yaml:"rate"`
+	Burst         int     `yaml:"burst"`
+	MaxConcurrent int     `yaml:"max_concurrent"`
+}
+
+// ClientLimits are the per-client budgets. Watch applies to WatchFiles
+// streams, which are held open for long, so its max_concurrent caps the
+// streams a single client keeps open.
+type ClientLimits struct {
+	Upload   RPCLimit `yaml:"upload"`
+	Download RPCLimit `yaml:"download"`
+	List     RPCLimit `yaml:"list"`
+	Metadata RPCLimit `yaml:"metadata"`
+	Watch    RPCLimit `yaml:"watch"`
+}
+
+// BandwidthLimit is a byte rate budget in bytes per second, zero means unlimited.
+type BandwidthLimit struct {
+	Global    int64 `yaml:"global"`
+	PerClient int64 `yaml:"per_client"`
+}
+
+type BandwidthLimits struct {
+	Upload   BandwidthLimit `yaml:"upload"`
+	Download BandwidthLimit `yaml:"download"`
+}
+
+// ImagePolicy describes which files are accepted as images.
+type ImagePolicy struct {
+	AllowedExtensions []string `yaml:"allowed_extensions"`
+	MaxSize           int64    `yaml:"max_size"`
+}
+
+// ArchiveLimits bounds uploaded archives: MaxSize the archive as sent,
+// MaxEntries and MaxTotalSize what it expands to.
+type ArchiveLimits struct {
+	MaxSize      int64 `yaml:"max_size"`
+	MaxEntries   int   `yaml:"max_entries"`
+	MaxTotalSize int64 `yaml:"max_total_size"`
+}
+
+// Events configures file change notifications. HistorySize events are kept
+// for watchers resuming from a sequence number.
+type Events struct {
+	HistorySize int `yaml:"history_size"`
+	MaxWatchers int `yaml:"max_watchers"`
+}
+
+// Versioning limits the older versions kept per file: at most MaxVersions,
+// none older than MaxAge. Zero means no limit.
+type Versioning struct {
+	MaxVersions int           `yaml:"max_versions"`
+	MaxAge      time.Duration `yaml:"max_age"`
+}
+
+// Trash keeps deleted files for Retention before the janitor, running every
+// JanitorInterval, removes them. Zero Retention deletes files immediately.
+type Trash struct {
+	Retention       time.Duration `yaml:"retention"`
+	JanitorInterval time.Duration `yaml:"janitor_interval"`
+}
+
+// LifecycleRule expires or moves to ColdStorageDir the files whose names
+// start with Prefix, ExpireAfter or ColdAfter their last write.
+type LifecycleRule struct {
+	Prefix      string        `yaml:"prefix"`
+	ExpireAfter time.Duration `yaml:"expire_after"`
+	ColdAfter   time.Duration `yaml:"cold_after"`
+}
+
+// Lifecycle configures the scheduler that runs every Interval to remove
+// files past their TTL and apply Rules. ColdStorageDir enables the cold tier.
+type Lifecycle struct {
+	Interval       time.Duration   `yaml:"interval"`
+	ColdStorageDir string          `yaml:"cold_storage_dir"`
+	Rules          []LifecycleRule `yaml:"rules"`
+}
+
+// Quota limits stored bytes and files, zero means no limit.
+type Quota struct {
+	MaxBytes int64 `yaml:"max_bytes"`
+	MaxFiles int64 `yaml:"max_files"`
+}
+
+// Quotas limit the whole storage and each owner, the client identity that
+// created a file. Owners without an entry in Owners get Default.
+type Quotas struct {
+	Global  Quota            `yaml:"global"`
+	Default Quota            `yaml:"default"`
+	Owners  map[string]Quota `yaml:"owners"`
+}
+
+// Webhook is a receiver of file events. Requests are signed with Secret.
+type Webhook struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+// Webhooks configures delivery of file events. Failed deliveries are retried
+// with exponential backoff from InitialBackoff up to MaxBackoff, undelivered
+// events are kept in SpoolDir across restarts, at most MaxPending per
+// endpoint.
+type Webhooks struct {
+	Endpoints      []Webhook     `yaml:"endpoints"`
+	SpoolDir       string        `yaml:"spool_dir"`
+	MaxPending     int           `yaml:"max_pending"`
+	Timeout        time.Duration `yaml:"timeout"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// TLS enables TLS when CertFile and KeyFile are set. ClientCAFile
+// additionally requires and verifies client certificates.
+type TLS struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// ShareLinks configures signed download links. Without Secret the server
+// generates one and keeps it in the metadata file. BaseURL is the public
+// address of the HTTP gateway used to build link URLs.
+type ShareLinks struct {
+	Secret     string        `yaml:"secret"`
+	DefaultTTL time.Duration `yaml:"default_ttl"`
+	MaxTTL     time.Duration `yaml:"max_ttl"`
+	BaseURL    string        `yaml:"base_url"`
+}
+
 type Config struct {
-	ServerAddress string
-	StorageDir    string
+	ServerAddress    string          `yaml:"server_address"`
+	HTTPAddress      string          `yaml:"http_address"`
+	HeaderTimeout    time.Duration   `yaml:"http_read_header_timeout"`
+	StorageDir       string          `yaml:"storage_dir"`
+	MetadataFile     string          `yaml:"metadata_file"`
+	LogLevel         string          `yaml:"log_level"`
+	LogFormat        string          `yaml:"log_format"`
+	Limits           Limits          `yaml:"limits"`
+	UploadTimeout    time.Duration   `yaml:"upload_timeout"`
+	ChunkSize        int             `yaml:"chunk_size"`
+	UploadBufferSize int             `yaml:"upload_buffer_size"`
+	ShutdownTimeout  time.Duration   `yaml:"shutdown_timeout"`
+	DrainDelay       time.Duration   `yaml:"drain_delay"`
+	HealthInterval   time.Duration   `yaml:"health_interval"`
+	Reflection       bool            `yaml:"reflection"`
+	ClientLimits     ClientLimits    `yaml:"client_limits"`
+	Bandwidth        BandwidthLimits `yaml:"bandwidth"`
+	ImagePolicy      ImagePolicy     `yaml:"image_policy"`
+	Archive          ArchiveLimits   `yaml:"archive"`
+	Events           Events          `yaml:"events"`
+	Versioning       Versioning      `yaml:"versioning"`
+	Trash            Trash           `yaml:"trash"`
+	Lifecycle        Lifecycle       `yaml:"lifecycle"`
+	Quotas           Quotas          `yaml:"quotas"`
+	Webhooks         Webhooks        `yaml:"webhooks"`
+	TLS              TLS             `yaml:"tls"`
+	ShareLinks       ShareLinks      `yaml:"share_links"`
+
+	// File is the YAML file the config was loaded from, if any.
+	File string `yaml:"-"`
 }
 
 func (c *Config) String() string {
-	return fmt.Sprintf("ServerAddress: %s, StorageDir: %s", c.ServerAddress, c.StorageDir)
+	shareLinks := c.ShareLinks
+	if shareLinks.Secret != "" {
+		shareLinks.Secret = "<redacted>"
+	}
+	webhooks := c.Webhooks
+	webhooks.Endpoints = nil
+	for _, endpoint := range c.Webhooks.Endpoints {
+		webhooks.Endpoints = append(webhooks.Endpoints, Webhook{URL: endpoint.URL, Secret: "<redacted>"})
+	}
+	return fmt.Sprintf("ServerAddress: %s, HTTPAddress: %s, HeaderTimeout: %s, StorageDir: %s, MetadataFile: %s, "+
+		"LogLevel: %s, LogFormat: %s, Limits: %+v, UploadTimeout: %s, ChunkSize: %d, UploadBufferSize: %d, ShutdownTimeout: %s, "+
+		"DrainDelay: %s, HealthInterval: %s, Reflection: %t, ClientLimits: %+v, Bandwidth: %+v, ImagePolicy: %+v, Archive: %+v, "+
+		"Events: %+v, Versioning: %+v, Trash: %+v, Lifecycle: %+v, Quotas: %+v, Webhooks: %+v, TLS: %+v, ShareLinks: %+v",
+		c.ServerAddress, c.HTTPAddress, c.HeaderTimeout, c.StorageDir, c.MetadataFile, c.LogLevel,
+		c.LogFormat, c.Limits, c.UploadTimeout, c.ChunkSize, c.UploadBufferSize, c.ShutdownTimeout,
+		c.DrainDelay, c.HealthInterval, c.Reflection, c.ClientLimits, c.Bandwidth, c.ImagePolicy, c.Archive,
+		c.Events, c.Versioning, c.Trash, c.Lifecycle, c.Quotas, webhooks, c.TLS, shareLinks)
 }
 
-func Load() *Config {
-	cfg := &Config{
-		ServerAddress: getEnv("SERVER_ADDRESS", defaultServerAddress),
-		StorageDir:    getEnv("STORAGE_DIR", defaultStorageDir),
+func Default() *Config {
+	return &Config{
+		ServerAddress:    defaultServerAddress,
+		HTTPAddress:      defaultHTTPAddress,
+		HeaderTimeout:    defaultHeaderTimeout,
+		StorageDir:       defaultStorageDir,
+		MetadataFile:     defaultMetadataFile,
+		LogLevel:         defaultLogLevel,
+		LogFormat:        defaultLogFormat,
+		Limits:           Limits{Upload: 10, Download: 10, List: 100, Metadata: 50},
+		UploadTimeout:    defaultUploadTimeout,
+		ChunkSize:        defaultChunkSize,
+		UploadBufferSize: defaultUploadBufferSize,
+		ShutdownTimeout:  defaultShutdownTimeout,
+		DrainDelay:       defaultDrainDelay,
+		HealthInterval:   defaultHealthInterval,
+		ClientLimits: ClientLimits{
+			Upload:   RPCLimit{Rate: 2, Burst: 5, MaxConcurrent: 2},
+			Download: RPCLimit{Rate: 10, Burst: 20, MaxConcurrent: 4},
+			List:     RPCLimit{Rate: 5, Burst: 10, MaxConcurrent: 10},
+			Metadata: RPCLimit{Rate: 5, Burst: 10, MaxConcurrent: 5},
+			Watch:    RPCLimit{Rate: 1, Burst: 5, MaxConcurrent: 5},
+		},
+		ImagePolicy: ImagePolicy{
+			AllowedExtensions: []string{".jpg", ".jpeg", ".png", ".gif", ".bmp"},
+		},
+		Archive: ArchiveLimits{
+			MaxSize:      defaultArchiveMaxSize,
+			MaxEntries:   defaultArchiveEntries,
+			MaxTotalSize: defaultArchiveTotalSize,
+		},
+		Events: Events{
+			HistorySize: defaultEventHistory,
+			MaxWatchers: defaultMaxWatchers,
+		},
+		Versioning: Versioning{
+			MaxVersions: defaultMaxVersions,
+		},
+		Trash: Trash{
+			Retention:       defaultTrashRetention,
+			JanitorInterval: defaultJanitorInterval,
+		},
+		Lifecycle: Lifecycle{
+			Interval: defaultLifecycleRun,
+		},
+		Webhooks: Webhooks{
+			SpoolDir:       defaultWebhookSpoolDir,
+			MaxPending:     defaultWebhookPending,
+			Timeout:        defaultWebhookTimeout,
+			MaxAttempts:    defaultWebhookAttempts,
+			InitialBackoff: defaultWebhookBackoff,
+			MaxBackoff:     defaultWebhookMaxWait,
+		},
+		ShareLinks: ShareLinks{
+			DefaultTTL: defaultShareLinkTTL,
+			MaxTTL:     defaultShareLinkMaxTTL,
+		},
 	}
+}
+
+// Load builds the configuration from defaults, the YAML file given by
+// -config or CONFIG_FILE, environment variables and command line flags,
+// in increasing order of precedence, and validates the result.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to YAML config file")
+
+	type flagValue struct {
+		opt   option
+		value string
+	}
+	var flagValues []flagValue
+	for _, opt := range options {
+		opt := opt
+		register := fs.Func
+		if opt.isBool {
+			register = fs.BoolFunc
+		}
+		register(opt.name, opt.usage+" (env "+opt.env+")", func(value string) error {
+			flagValues = append(flagValues, flagValue{opt: opt, value: value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return nil, err
+		}
+		cfg.File = *configPath
+	}
+	for _, opt := range options {
+		value, ok := os.LookupEnv(opt.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := opt.set(cfg, value); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", opt.env, err)
+		}
+	}
+	for _, fv := range flagValues {
+		if err := fv.opt.set(cfg, fv.value); err != nil {
+			return nil, fmt.Errorf("invalid value for -%s: %w", fv.opt.name, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	defer file.Close()
 
-	return cfg
+	dec := yaml.NewDecoder(file)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
 }
 
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		fmt.Printf("Using default value for %s: %s\n", key, defaultValue)
-		return defaultValue
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.ServerAddress != "", "server_address must not be empty")
+	check(c.HeaderTimeout > 0, "http_read_header_timeout must be positive, got %s", c.HeaderTimeout)
+	check(c.StorageDir != "", "storage_dir must not be empty")
+	check(c.MetadataFile != "", "metadata_file must not be empty")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil,
+		"log_level %q must be one of debug, info, warn, error", c.LogLevel)
+	format := strings.ToLower(c.LogFormat)
+	check(format == "text" || format == "json", "log_format %q must be text or json", c.LogFormat)
+
+	check(c.Limits.Upload > 0, "limits.upload must be positive, got %d", c.Limits.Upload)
+	check(c.Limits.Download > 0, "limits.download must be positive, got %d", c.Limits.Download)
+	check(c.Limits.List > 0, "limits.list must be positive, got %d", c.Limits.List)
+	check(c.Limits.Metadata > 0, "limits.metadata must be positive, got %d", c.Limits.Metadata)
+	check(c.UploadTimeout > 0, "upload_timeout must be positive, got %s", c.UploadTimeout)
+	check(c.ChunkSize > 0 && c.ChunkSize <= maxChunkSize,
+		"chunk_size must be between 1 and %d, got %d", maxChunkSize, c.ChunkSize)
+	check(c.UploadBufferSize > 0, "upload_buffer_size must be positive, got %d", c.UploadBufferSize)
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive, got %s", c.ShutdownTimeout)
+	check(c.DrainDelay >= 0 && c.DrainDelay < c.ShutdownTimeout,
+		"drain_delay must be at least 0 and less than shutdown_timeout %s, got %s", c.ShutdownTimeout, c.DrainDelay)
+	check(c.HealthInterval > 0, "health_interval must be positive, got %s", c.HealthInterval)
+
+	rpcLimits := []struct {
+		name  string
+		limit RPCLimit
+	}{
+		{"upload", c.ClientLimits.Upload},
+		{"download", c.ClientLimits.Download},
+		{"list", c.ClientLimits.List},
+		{"metadata", c.ClientLimits.Metadata},
+		{"watch", c.ClientLimits.Watch},
+	}
+	for _, l := range rpcLimits {
+		check(l.limit.Rate >= 0, "client_limits.%s.rate must not be negative, got %g", l.name, l.limit.Rate)
+		check(l.limit.Burst >= 0, "client_limits.%s.burst must not be negative, got %d", l.name, l.limit.Burst)
+		check(l.limit.MaxConcurrent >= 0,
+			"client_limits.%s.max_concurrent must not be negative, got %d", l.name, l.limit.MaxConcurrent)
+	}
+	bandwidthLimits := []struct {
+		name  string
+		limit BandwidthLimit
+	}{
+		{"upload", c.Bandwidth.Upload},
+		{"download", c.Bandwidth.Download},
+	}
+	for _, b := range bandwidthLimits {
+		check(b.limit.Global >= 0, "bandwidth.%s.global must not be negative, got %d", b.name, b.limit.Global)
+		check(b.limit.PerClient >= 0,
+			"bandwidth.%s.per_client must not be negative, got %d", b.name, b.limit.PerClient)
+	}
+
+	check(len(c.ImagePolicy.AllowedExtensions) > 0, "image_policy.allowed_extensions must not be empty")
+	for _, ext := range c.ImagePolicy.AllowedExtensions {
+		check(strings.HasPrefix(ext, ".") && len(ext) > 1,
+			"image_policy.allowed_extensions entry %q must start with a dot", ext)
+	}
+	check(c.ImagePolicy.MaxSize >= 0, "image_policy.max_size must not be negative, got %d", c.ImagePolicy.MaxSize)
+
+	check(c.Archive.MaxSize > 0, "archive.max_size must be positive, got %d", c.Archive.MaxSize)
+	check(c.Archive.MaxEntries > 0, "archive.max_entries must be positive, got %d", c.Archive.MaxEntries)
+	check(c.Archive.MaxTotalSize > 0, "archive.max_total_size must be positive, got %d", c.Archive.MaxTotalSize)
+
+	check(c.Events.HistorySize > 0, "events.history_size must be positive, got %d", c.Events.HistorySize)
+	check(c.Events.MaxWatchers > 0, "events.max_watchers must be positive, got %d", c.Events.MaxWatchers)
+
+	check(c.Versioning.MaxVersions >= 0,
+		"versioning.max_versions must not be negative, got %d", c.Versioning.MaxVersions)
+	check(c.Versioning.MaxAge >= 0, "versioning.max_age must not be negative, got %s", c.Versioning.MaxAge)
+
+	check(c.Trash.Retention >= 0, "trash.retention must not be negative, got %s", c.Trash.Retention)
+	check(c.Trash.JanitorInterval > 0, "trash.janitor_interval must be positive, got %s", c.Trash.JanitorInterval)
+
+	check(c.Lifecycle.Interval > 0, "lifecycle.interval must be positive, got %s", c.Lifecycle.Interval)
+	for _, rule := range c.Lifecycle.Rules {
+		check(rule.ExpireAfter >= 0 && rule.ColdAfter >= 0,
+			"lifecycle.rules %q durations must not be negative", rule.Prefix)
+		check(rule.ExpireAfter > 0 || rule.ColdAfter > 0,
+			"lifecycle.rules %q must set expire_after or cold_after", rule.Prefix)
+		check(rule.ColdAfter == 0 || c.Lifecycle.ColdStorageDir != "",
+			"lifecycle.rules %q cold_after requires lifecycle.cold_storage_dir", rule.Prefix)
+		check(rule.ColdAfter == 0 || rule.ExpireAfter == 0 || rule.ColdAfter < rule.ExpireAfter,
+			"lifecycle.rules %q cold_after must be shorter than expire_after", rule.Prefix)
+	}
+
+	quotas := map[string]Quota{"global": c.Quotas.Global, "default": c.Quotas.Default}
+	for owner, quota := range c.Quotas.Owners {
+		quotas["owners."+owner] = quota
+	}
+	for name, quota := range quotas {
+		check(quota.MaxBytes >= 0 && quota.MaxFiles >= 0, "quotas.%s limits must not be negative", name)
+	}
+
+	for _, endpoint := range c.Webhooks.Endpoints {
+		u, err := url.Parse(endpoint.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"webhooks.endpoints url %q must be an absolute http or https URL", endpoint.URL)
+		check(endpoint.Secret != "", "webhooks.endpoints secret for %q must not be empty", endpoint.URL)
+	}
+	check(c.Webhooks.SpoolDir != "", "webhooks.spool_dir must not be empty")
+	check(c.Webhooks.MaxPending > 0, "webhooks.max_pending must be positive, got %d", c.Webhooks.MaxPending)
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive, got %s", c.Webhooks.Timeout)
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive, got %d", c.Webhooks.MaxAttempts)
+	check(c.Webhooks.InitialBackoff > 0, "webhooks.initial_backoff must be positive, got %s", c.Webhooks.InitialBackoff)
+	check(c.Webhooks.MaxBackoff >= c.Webhooks.InitialBackoff,
+		"webhooks.max_backoff %s must not be less than webhooks.initial_backoff %s",
+		c.Webhooks.MaxBackoff, c.Webhooks.InitialBackoff)
+
+	if c.TLS.Enabled() {
+		check(c.TLS.CertFile != "" && c.TLS.KeyFile != "", "tls.cert_file and tls.key_file must be set together")
+	}
+	check(c.TLS.ClientCAFile == "" || c.TLS.Enabled(), "tls.client_ca_file requires tls.cert_file and tls.key_file")
+
+	check(c.ShareLinks.DefaultTTL > 0, "share_links.default_ttl must be positive, got %s", c.ShareLinks.DefaultTTL)
+	check(c.ShareLinks.MaxTTL >= c.ShareLinks.DefaultTTL,
+		"share_links.max_ttl %s must not be less than share_links.default_ttl %s",
+		c.ShareLinks.MaxTTL, c.ShareLinks.DefaultTTL)
+	if c.ShareLinks.BaseURL != "" {
+		u, err := url.Parse(c.ShareLinks.BaseURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"share_links.base_url %q must be an absolute http or https URL", c.ShareLinks.BaseURL)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
 	}
-	fmt.Printf("Loaded %s from environment: %s\n", key, value)
-	return value
+	return nil
 }
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// option is a setting that can be overridden by an environment variable and
+// a command line flag.
+type option struct {
+	name  string
+	env   string
+	usage string
+	// isBool options can be given as a bare flag, e.g. -reflection
+	isBool bool
+	set    func(c *Config, value string) error
+}
+
+var options = []option{
+	stringOption("address", "SERVER_ADDRESS", "gRPC listen address",
+		func(c *Config) *string { return &c.ServerAddress }),
+	stringOption("http-address", "HTTP_ADDRESS", "HTTP gateway listen address, empty to disable",
+		func(c *Config) *string { return &c.HTTPAddress }),
+	durationOption("http-read-header-timeout", "HTTP_READ_HEADER_TIMEOUT", "max time to read HTTP request headers",
+		func(c *Config) *time.Duration { return &c.HeaderTimeout }),
+	stringOption("storage-dir", "STORAGE_DIR", "directory for stored files",
+		func(c *Config) *string { return &c.StorageDir }),
+	stringOption("metadata-file", "METADATA_FILE", "file for file metadata and share links",
+		func(c *Config) *string { return &c.MetadataFile }),
+	stringOption("log-level", "LOG_LEVEL", "log level: debug, info, warn or error",
+		func(c *Config) *string { return &c.LogLevel }),
+	stringOption("log-format", "LOG_FORMAT", "log format: text or json",
+		func(c *Config) *string { return &c.LogFormat }),
+
+	intOption("upload-limit", "UPLOAD_LIMIT", "max concurrent uploads",
+		func(c *Config) *int { return &c.Limits.Upload }),
+	intOption("download-limit", "DOWNLOAD_LIMIT", "max concurrent downloads",
+		func(c *Config) *int { return &c.Limits.Download }),
+	intOption("list-limit", "LIST_LIMIT", "max concurrent list calls",
+		func(c *Config) *int { return &c.Limits.List }),
+	intOption("metadata-limit", "METADATA_LIMIT", "max concurrent metadata and share link changes",
+		func(c *Config) *int { return &c.Limits.Metadata }),
+	durationOption("upload-timeout", "UPLOAD_TIMEOUT", "max duration of a single upload",
+		func(c *Config) *time.Duration { return &c.UploadTimeout }),
+	intOption("chunk-size", "CHUNK_SIZE", "download chunk size in bytes",
+		func(c *Config) *int { return &c.ChunkSize }),
+	intOption("upload-buffer-size", "UPLOAD_BUFFER_SIZE", "number of upload chunks buffered in memory",
+		func(c *Config) *int { return &c.UploadBufferSize }),
+	durationOption("shutdown-timeout", "SHUTDOWN_TIMEOUT", "time to drain in-flight calls before forcing shutdown",
+		func(c *Config) *time.Duration { return &c.ShutdownTimeout }),
+	durationOption("drain-delay", "DRAIN_DELAY", "time to keep serving after reporting NOT_SERVING on shutdown",
+		func(c *Config) *time.Duration { return &c.DrainDelay }),
+	durationOption("health-interval", "HEALTH_INTERVAL", "interval between storage health checks",
+		func(c *Config) *time.Duration { return &c.HealthInterval }),
+	boolOption("reflection", "GRPC_REFLECTION", "enable gRPC server reflection",
+		func(c *Config) *bool { return &c.Reflection }),
+
+	floatOption("upload-client-rate", "UPLOAD_CLIENT_RATE", "upload requests per second per client",
+		func(c *Config) *float64 { return &c.ClientLimits.Upload.Rate }),
+	intOption("upload-client-burst", "UPLOAD_CLIENT_BURST", "upload request burst per client",
+		func(c *Config) *int { return &c.ClientLimits.Upload.Burst }),
+	intOption("upload-client-max-streams", "UPLOAD_CLIENT_MAX_STREAMS", "concurrent uploads per client",
+		func(c *Config) *int { return &c.ClientLimits.Upload.MaxConcurrent }),
+	floatOption("download-client-rate", "DOWNLOAD_CLIENT_RATE", "download requests per second per client",
+		func(c *Config) *float64 { return &c.ClientLimits.Download.Rate }),
+	intOption("download-client-burst", "DOWNLOAD_CLIENT_BURST", "download request burst per client",
+		func(c *Config) *int { return &c.ClientLimits.Download.Burst }),
+	intOption("download-client-max-streams", "DOWNLOAD_CLIENT_MAX_STREAMS", "concurrent downloads per client",
+		func(c *Config) *int { return &c.ClientLimits.Download.MaxConcurrent }),
+	floatOption("list-client-rate", "LIST_CLIENT_RATE", "list requests per second per client",
+		func(c *Config) *float64 { return &c.ClientLimits.List.Rate }),
+	intOption("list-client-burst", "LIST_CLIENT_BURST", "list request burst per client",
+		func(c *Config) *int { return &c.ClientLimits.List.Burst }),
+	intOption("list-client-max-streams", "LIST_CLIENT_MAX_STREAMS", "concurrent list calls per client",
+		func(c *Config) *int { return &c.ClientLimits.List.MaxConcurrent }),
+	floatOption("metadata-client-rate", "METADATA_CLIENT_RATE", "metadata changes per second per client",
+		func(c *Config) *float64 { return &c.ClientLimits.Metadata.Rate }),
+	intOption("metadata-client-burst", "METADATA_CLIENT_BURST", "metadata change burst per client",
+		func(c *Config) *int { return &c.ClientLimits.Metadata.Burst }),
+	intOption("metadata-client-max-streams", "METADATA_CLIENT_MAX_STREAMS", "concurrent metadata changes per client",
+		func(c *Config) *int { return &c.ClientLimits.Metadata.MaxConcurrent }),
+	floatOption("watch-client-rate", "WATCH_CLIENT_RATE", "WatchFiles calls per second per client",
+		func(c *Config) *float64 { return &c.ClientLimits.Watch.Rate }),
+	intOption("watch-client-burst", "WATCH_CLIENT_BURST", "WatchFiles call burst per client",
+		func(c *Config) *int { return &c.ClientLimits.Watch.Burst }),
+	intOption("watch-client-max-streams", "WATCH_CLIENT_MAX_STREAMS", "concurrent WatchFiles streams per client",
+		func(c *Config) *int { return &c.ClientLimits.Watch.MaxConcurrent }),
+
+	int64Option("upload-bandwidth-global", "UPLOAD_BANDWIDTH_GLOBAL", "total upload bytes per second",
+		func(c *Config) *int64 { return &c.Bandwidth.Upload.Global }),
+	int64Option("upload-bandwidth-client", "UPLOAD_BANDWIDTH_CLIENT", "upload bytes per second per client",
+		func(c *Config) *int64 { return &c.Bandwidth.Upload.PerClient }),
+	int64Option("download-bandwidth-global", "DOWNLOAD_BANDWIDTH_GLOBAL", "total download bytes per second",
+		func(c *Config) *int64 { return &c.Bandwidth.Download.Global }),
+	int64Option("download-bandwidth-client", "DOWNLOAD_BANDWIDTH_CLIENT", "download bytes per second per client",
+		func(c *Config) *int64 { return &c.Bandwidth.Download.PerClient }),
+
+	listOption("image-extensions", "IMAGE_EXTENSIONS", "comma separated list of accepted image extensions",
+		func(c *Config) *[]string { return &c.ImagePolicy.AllowedExtensions }),
+	int64Option("image-max-size", "IMAGE_MAX_SIZE", "max image size in bytes, 0 - unlimited",
+		func(c *Config) *int64 { return &c.ImagePolicy.MaxSize }),
+
+	int64Option("archive-max-size", "ARCHIVE_MAX_SIZE", "max size of an uploaded archive in bytes",
+		func(c *Config) *int64 { return &c.Archive.MaxSize }),
+	intOption("archive-max-entries", "ARCHIVE_MAX_ENTRIES", "max number of entries in an uploaded archive",
+		func(c *Config) *int { return &c.Archive.MaxEntries }),
+	int64Option("archive-max-total-size", "ARCHIVE_MAX_TOTAL_SIZE", "max extracted size of an uploaded archive in bytes",
+		func(c *Config) *int64 { return &c.Archive.MaxTotalSize }),
+
+	intOption("event-history", "EVENT_HISTORY_SIZE", "number of file events kept for resuming watchers",
+		func(c *Config) *int { return &c.Events.HistorySize }),
+	intOption("max-watchers", "MAX_WATCHERS", "max concurrent WatchFiles streams",
+		func(c *Config) *int { return &c.Events.MaxWatchers }),
+
+	intOption("versioning-max-versions", "VERSIONING_MAX_VERSIONS", "older versions kept per file, 0 - unlimited",
+		func(c *Config) *int { return &c.Versioning.MaxVersions }),
+	durationOption("versioning-max-age", "VERSIONING_MAX_AGE", "max age of older file versions, 0 - unlimited",
+		func(c *Config) *time.Duration { return &c.Versioning.MaxAge }),
+
+	durationOption("trash-retention", "TRASH_RETENTION", "how long deleted files stay in the trash, 0 - delete immediately",
+		func(c *Config) *time.Duration { return &c.Trash.Retention }),
+	durationOption("trash-janitor-interval", "TRASH_JANITOR_INTERVAL", "interval between purges of expired trash",
+		func(c *Config) *time.Duration { return &c.Trash.JanitorInterval }),
+
+	durationOption("lifecycle-interval", "LIFECYCLE_INTERVAL", "interval between runs of TTL and lifecycle rules",
+		func(c *Config) *time.Duration { return &c.Lifecycle.Interval }),
+	stringOption("cold-storage-dir", "COLD_STORAGE_DIR", "directory of the cold storage tier, empty - disabled",
+		func(c *Config) *string { return &c.Lifecycle.ColdStorageDir }),
+
+	int64Option("quota-global-bytes", "QUOTA_GLOBAL_BYTES", "max bytes stored in total, 0 - unlimited",
+		func(c *Config) *int64 { return &c.Quotas.Global.MaxBytes }),
+	int64Option("quota-global-files", "QUOTA_GLOBAL_FILES", "max files stored in total, 0 - unlimited",
+		func(c *Config) *int64 { return &c.Quotas.Global.MaxFiles }),
+	int64Option("quota-owner-bytes", "QUOTA_OWNER_BYTES", "max bytes stored per owner, 0 - unlimited",
+		func(c *Config) *int64 { return &c.Quotas.Default.MaxBytes }),
+	int64Option("quota-owner-files", "QUOTA_OWNER_FILES", "max files stored per owner, 0 - unlimited",
+		func(c *Config) *int64 { return &c.Quotas.Default.MaxFiles }),
+
+	stringOption("webhook-spool-dir", "WEBHOOK_SPOOL_DIR", "directory for undelivered webhook events",
+		func(c *Config) *string { return &c.Webhooks.SpoolDir }),
+	intOption("webhook-max-pending", "WEBHOOK_MAX_PENDING", "undelivered webhook events kept per endpoint",
+		func(c *Config) *int { return &c.Webhooks.MaxPending }),
+	durationOption("webhook-timeout", "WEBHOOK_TIMEOUT", "timeout of a single webhook request",
+		func(c *Config) *time.Duration { return &c.Webhooks.Timeout }),
+	intOption("webhook-max-attempts", "WEBHOOK_MAX_ATTEMPTS", "delivery attempts before a webhook event is given up",
+		func(c *Config) *int { return &c.Webhooks.MaxAttempts }),
+	durationOption("webhook-initial-backoff", "WEBHOOK_INITIAL_BACKOFF", "delay before the first webhook retry",
+		func(c *Config) *time.Duration { return &c.Webhooks.InitialBackoff }),
+	durationOption("webhook-max-backoff", "WEBHOOK_MAX_BACKOFF", "max delay between webhook retries",
+		func(c *Config) *time.Duration { return &c.Webhooks.MaxBackoff }),
+
+	stringOption("tls-cert", "TLS_CERT_FILE", "TLS certificate file",
+		func(c *Config) *string { return &c.TLS.CertFile }),
+	stringOption("tls-key", "TLS_KEY_FILE", "TLS private key file",
+		func(c *Config) *string { return &c.TLS.KeyFile }),
+	stringOption("tls-client-ca", "TLS_CLIENT_CA_FILE", "CA file used to verify client certificates",
+		func(c *Config) *string { return &c.TLS.ClientCAFile }),
+
+	stringOption("share-link-secret", "SHARE_LINK_SECRET", "key for signing share links, generated if empty",
+		func(c *Config) *string { return &c.ShareLinks.Secret }),
+	durationOption("share-link-ttl", "SHARE_LINK_TTL", "share link lifetime when the client does not set one",
+		func(c *Config) *time.Duration { return &c.ShareLinks.DefaultTTL }),
+	durationOption("share-link-max-ttl", "SHARE_LINK_MAX_TTL", "max share link lifetime",
+		func(c *Config) *time.Duration { return &c.ShareLinks.MaxTTL }),
+	stringOption("share-link-base-url", "SHARE_LINK_BASE_URL", "public HTTP gateway URL used in share links",
+		func(c *Config) *string { return &c.ShareLinks.BaseURL }),
+}
+
+func stringOption(name, env, usage string, field func(*Config) *string) option {
+	return option{name: name, env: env, usage: usage, set: func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func intOption(name, env, usage string, field func(*Config) *int) option {
+	return option{name: name, env: env, usage: usage, set: func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func int64Option(name, env, usage string, field func(*Config) *int64) option {
+	return option{name: name, env: env, usage: usage, set: func(c *Config, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func floatOption(name, env, usage string, field func(*Config) *float64) option {
+	return option{name: name, env: env, usage: usage, set: func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}}
+}
+
+func durationOption(name, env, usage string, field func(*Config) *time.Duration) option {
+	return option{name: name, env: env, usage: usage, set: func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}}
+}
+
+func boolOption(name, env, usage string, field func(*Config) *bool) option {
+	return option{name: name, env: env, usage: usage, isBool: true, set: func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+func listOption(name, env, usage string, field func(*Config) *[]string) option {
+	return option{name: name, env: env, usage: usage, set: func(c *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}}
+}
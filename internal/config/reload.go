@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// CheckReloadable reports an error if next changes settings that can only
+// take effect after a restart.
+func CheckReloadable(current, next *Config) error {
+	var fixed []string
+	if current.ServerAddress != next.ServerAddress {
+		fixed = append(fixed, "server_address")
+	}
+	if current.HTTPAddress != next.HTTPAddress {
+		fixed = append(fixed, "http_address")
+	}
+	if current.HeaderTimeout != next.HeaderTimeout {
+		fixed = append(fixed, "http_read_header_timeout")
+	}
+	if current.StorageDir != next.StorageDir {
+		fixed = append(fixed, "storage_dir")
+	}
+	if current.MetadataFile != next.MetadataFile {
+		fixed = append(fixed, "metadata_file")
+	}
+	if !strings.EqualFold(current.LogFormat, next.LogFormat) {
+		fixed = append(fixed, "log_format")
+	}
+	if current.UploadTimeout != next.UploadTimeout {
+		fixed = append(fixed, "upload_timeout")
+	}
+	if current.ChunkSize != next.ChunkSize {
+		fixed = append(fixed, "chunk_size")
+	}
+	if current.UploadBufferSize != next.UploadBufferSize {
+		fixed = append(fixed, "upload_buffer_size")
+	}
+	if current.DrainDelay != next.DrainDelay {
+		fixed = append(fixed, "drain_delay")
+	}
+	if current.HealthInterval != next.HealthInterval {
+		fixed = append(fixed, "health_interval")
+	}
+	if current.Reflection != next.Reflection {
+		fixed = append(fixed, "reflection")
+	}
+	if current.Trash.JanitorInterval != next.Trash.JanitorInterval {
+		fixed = append(fixed, "trash.janitor_interval")
+	}
+	if current.Lifecycle.Interval != next.Lifecycle.Interval {
+		fixed = append(fixed, "lifecycle.interval")
+	}
+	if current.Lifecycle.ColdStorageDir != next.Lifecycle.ColdStorageDir {
+		fixed = append(fixed, "lifecycle.cold_storage_dir")
+	}
+	if current.Events != next.Events {
+		fixed = append(fixed, "events")
+	}
+	if !reflect.DeepEqual(current.Webhooks, next.Webhooks) {
+		fixed = append(fixed, "webhooks")
+	}
+	if current.TLS.Enabled() != next.TLS.Enabled() {
+		fixed = append(fixed, "tls (enabling or disabling)")
+	}
+	if current.ShareLinks.Secret != next.ShareLinks.Secret {
+		fixed = append(fixed, "share_links.secret")
+	}
+	if len(fixed) > 0 {
+		return fmt.Errorf("changing %s requires a restart", strings.Join(fixed, ", "))
+	}
+	return nil
+}
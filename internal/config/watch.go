@@ -0,0 +1,44 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Watch polls path every interval and sends to the returned channel when
+// the file's size or modification time changes. Polling also picks up
+// editors and deploy tools that replace the file instead of writing it.
+func Watch(ctx context.Context, path string, interval time.Duration) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	last, _ := os.Stat(path)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				info, err := os.Stat(path)
+				if err != nil || sameFile(last, info) {
+					continue
+				}
+				last = info
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes
+}
+
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
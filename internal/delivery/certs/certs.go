@@ -0,0 +1,75 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"tagesTest/internal/config"
+)
+
+// Reloader serves the most recently loaded certificates to new connections,
+// so certificates can be rotated without a restart. It is shared by the gRPC
+// and HTTP servers.
+type Reloader struct {
+	current atomic.Pointer[tls.Config]
+}
+
+func NewReloader(cfg config.TLS) (*Reloader, error) {
+	tlsConfig, err := load(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reloader{}
+	r.current.Store(tlsConfig)
+	return r, nil
+}
+
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// Reload loads new certificates and starts serving them. On error the
+// current certificates stay in use.
+func (r *Reloader) Reload(cfg config.TLS) error {
+	tlsConfig, err := load(cfg)
+	if err != nil {
+		return err
+	}
+	r.current.Store(tlsConfig)
+	return nil
+}
+
+func load(cfg config.TLS) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,181 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/archive"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+	"tagesTest/internal/service"
+	pb "tagesTest/proto"
+)
+
+// UploadArchive extracts a ZIP, tar or tar.gz archive into storage. Every
+// entry goes through the same checks as UploadFile and gets its own result.
+func (h *FileServiceHandler) UploadArchive(stream pb.FileService_UploadArchiveServer) error {
+	ctx, cancel := context.WithTimeout(stream.Context(), h.uploadTimeout)
+	defer cancel()
+
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to receive archive: %v", err)
+	}
+	files, err := h.bucket(ctx, first.Bucket)
+	if err != nil {
+		return err
+	}
+
+	dataChan := make(chan []byte, h.uploadBufferSize)
+	errChan := make(chan error, 1)
+	go h.receivingLoop(ctx, dataChan, errChan, func() ([]byte, error) {
+		if first != nil {
+			chunk := first.Chunk
+			first = nil
+			return chunk, nil
+		}
+		req, err := stream.Recv()
+		return req.GetChunk(), err
+	})
+
+	chunks := &chunkReader{ctx: ctx, dataChan: dataChan, errChan: errChan}
+	source := h.policy.ArchiveReader(ctx, clientIdentity(ctx), chunks)
+	resp := &pb.UploadArchiveResponse{}
+	err = archive.Walk(source, "", h.policy.ArchiveLimits(), func(entry archive.Entry) error {
+		result := h.extractEntry(ctx, files, entry)
+		if result.Ok {
+			resp.Uploaded++
+		} else {
+			resp.Failed++
+		}
+		resp.Entries = append(resp.Entries, result)
+		return ctx.Err()
+	})
+	logger.AddAttrs(ctx, slog.Int("uploaded", int(resp.Uploaded)), slog.Int("failed", int(resp.Failed)))
+	if err != nil {
+		// without any extracted entry there is no report worth sending
+		if len(resp.Entries) == 0 || ctx.Err() != nil || isStatus(err) {
+			return toStatus(err, "failed to extract archive")
+		}
+		resp.Error = err.Error()
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (h *FileServiceHandler) extractEntry(
+	ctx context.Context, files *service.FileService, entry archive.Entry,
+) *pb.ArchiveEntryResult {
+	result := &pb.ArchiveEntryResult{Name: entry.Name}
+	if entry.Err != nil {
+		result.Error = entry.Err.Error()
+		return result
+	}
+
+	filename := entry.Name
+	result.Filename = filename
+	if !h.policy.IsImage(filename) {
+		result.Error = "not an image"
+		return result
+	}
+	bucket := files.Bucket()
+	if !bucket.Allows(filename) {
+		result.Error = "file type not allowed in bucket " + bucket.Name
+		return result
+	}
+
+	owner := clientIdentity(ctx)
+	body := h.policy.BucketReader(bucket, h.policy.EntryReader(entry.Body))
+	// existing files are rejected by the create-only write itself
+	saved, err := files.WriteFile(filename, body, domain.WriteOptions{
+		Mode:   domain.WriteCreateOnly,
+		Owner:  owner,
+		Quotas: h.policy.Quotas(bucket, owner),
+	})
+	if errors.Is(err, domain.ErrFileExists) {
+		result.Error = "file already exists"
+		return result
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Ok = true
+	result.Size = uint32(saved.Size)
+	return result
+}
+
+func isStatus(err error) bool {
+	var se interface{ GRPCStatus() *status.Status }
+	return errors.As(err, &se)
+}
+
+func (h *FileServiceHandler) DownloadArchive(
+	req *pb.DownloadArchiveRequest, stream pb.FileService_DownloadArchiveServer,
+) error {
+	ctx := stream.Context()
+	release, err := h.policy.Acquire(ctx, policy.Download)
+	if err != nil {
+		return status.Errorf(codes.ResourceExhausted, "download limit reached")
+	}
+	defer release()
+
+	if len(req.Filenames) == 0 && req.Prefix == "" {
+		return status.Errorf(codes.InvalidArgument, "filenames or prefix required")
+	}
+	format := archive.Zip
+	if req.Format == pb.ArchiveFormat_ARCHIVE_FORMAT_TAR_GZ {
+		format = archive.TarGz
+	}
+	files, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return err
+	}
+
+	// the archive is built while it is sent, the pipe keeps the producer in
+	// step with the stream
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		manifest, err := files.WriteArchive(ctx, pw, service.ArchiveRequest{
+			Filenames: req.Filenames,
+			Prefix:    req.Prefix,
+			Format:    format,
+			Accept:    h.policy.IsImage,
+		})
+		logger.AddAttrs(ctx, slog.Int("files", len(manifest.Files)), slog.Int("missing", len(manifest.Missing)))
+		pw.CloseWithError(err)
+	}()
+
+	source := h.policy.DownloadReader(ctx, clientIdentity(ctx), pr)
+	var totalSize int64
+	buffer := make([]byte, h.chunkSize)
+	for {
+		n, err := source.Read(buffer)
+		if n > 0 {
+			if err := stream.Send(&pb.DownloadArchiveResponse{Chunk: buffer[:n]}); err != nil {
+				return status.Errorf(codes.Internal, "failed to send chunk: %v", err)
+			}
+			totalSize += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return toStatus(err, "failed to build archive")
+		}
+	}
+
+	logger.AddAttrs(ctx, slog.Int64("bytes", totalSize))
+	return nil
+}
@@ -0,0 +1,99 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+	"tagesTest/internal/service"
+	pb "tagesTest/proto"
+)
+
+// bucket returns the service of the named bucket, or of the default one if
+// name is empty.
+func (h *FileServiceHandler) bucket(ctx context.Context, name string) (*service.FileService, error) {
+	if name != "" {
+		logger.AddAttrs(ctx, slog.String("bucket", name))
+	}
+	bucket, err := h.buckets.Get(name)
+	if err != nil {
+		return nil, toStatus(err, "failed to open bucket")
+	}
+	return bucket, nil
+}
+
+func (h *FileServiceHandler) CreateBucket(
+	ctx context.Context, req *pb.CreateBucketRequest,
+) (*pb.CreateBucketResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("bucket", req.Name))
+	bucket, err := h.buckets.Create(domain.Bucket{
+		Name:              req.Name,
+		AllowedExtensions: req.AllowedExtensions,
+		MaxFileSize:       int64(req.MaxFileSize),
+		Quota:             domain.Quota{MaxBytes: int64(req.MaxBytes), MaxFiles: int64(req.MaxFiles)},
+	})
+	if err != nil {
+		return nil, toStatus(err, "failed to create bucket")
+	}
+	return &pb.CreateBucketResponse{Bucket: toBucket(bucket)}, nil
+}
+
+func (h *FileServiceHandler) ListBuckets(ctx context.Context, req *pb.ListBucketsRequest) (*pb.ListBucketsResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.List)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "list limit reached")
+	}
+	defer release()
+
+	resp := &pb.ListBucketsResponse{}
+	for _, bucket := range h.buckets.List() {
+		files, err := h.buckets.Get(bucket.Name)
+		if err != nil {
+			// deleted meanwhile
+			continue
+		}
+		info := toBucket(bucket)
+		info.Usage = toUsage(files.BucketUsage(), h.policy.Quotas(bucket, "").Bucket)
+		resp.Buckets = append(resp.Buckets, info)
+	}
+	logger.AddAttrs(ctx, slog.Int("buckets", len(resp.Buckets)))
+	return resp, nil
+}
+
+func (h *FileServiceHandler) DeleteBucket(
+	ctx context.Context, req *pb.DeleteBucketRequest,
+) (*pb.DeleteBucketResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("bucket", req.Name), slog.Bool("force", req.Force))
+	if err := h.buckets.Delete(req.Name, req.Force); err != nil {
+		return nil, toStatus(err, "failed to delete bucket")
+	}
+	return &pb.DeleteBucketResponse{}, nil
+}
+
+func toBucket(bucket domain.Bucket) *pb.Bucket {
+	return &pb.Bucket{
+		Name:              bucket.Name,
+		CreatedAt:         bucket.CreatedAt.Format(time.RFC3339),
+		AllowedExtensions: bucket.AllowedExtensions,
+		MaxFileSize:       uint64(bucket.MaxFileSize),
+		MaxBytes:          uint64(bucket.Quota.MaxBytes),
+		MaxFiles:          uint64(bucket.Quota.MaxFiles),
+	}
+}
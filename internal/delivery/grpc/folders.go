@@ -0,0 +1,74 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/logger"
+	pb "tagesTest/proto"
+)
+
+func (h *FileServiceHandler) CreateFolder(
+	ctx context.Context, req *pb.CreateFolderRequest,
+) (*pb.CreateFolderResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("folder", req.Path))
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if err := bucket.CreateFolder(req.Path); err != nil {
+		return nil, toStatus(err, "failed to create folder")
+	}
+	return &pb.CreateFolderResponse{}, nil
+}
+
+func (h *FileServiceHandler) MoveFolder(ctx context.Context, req *pb.MoveFolderRequest) (*pb.MoveFolderResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("folder", req.From), slog.String("to", req.To))
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	moved, err := bucket.MoveFolder(req.From, req.To, clientIdentity(ctx))
+	logger.AddAttrs(ctx, slog.Int("moved", moved))
+	if err != nil {
+		return nil, toStatus(err, "failed to move folder")
+	}
+	return &pb.MoveFolderResponse{Moved: uint32(moved)}, nil
+}
+
+func (h *FileServiceHandler) DeleteFolder(
+	ctx context.Context, req *pb.DeleteFolderRequest,
+) (*pb.DeleteFolderResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("folder", req.Path), slog.Bool("recursive", req.Recursive))
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := bucket.DeleteFolder(req.Path, req.Recursive, h.policy.TrashRetention())
+	logger.AddAttrs(ctx, slog.Int("deleted", deleted))
+	if err != nil {
+		return nil, toStatus(err, "failed to delete folder")
+	}
+	return &pb.DeleteFolderResponse{Deleted: uint32(deleted)}, nil
+}
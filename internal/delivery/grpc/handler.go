@@ -2,118 +2,171 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"tagesTest/internal/archive"
+	"tagesTest/internal/config"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/events"
+	"tagesTest/internal/logger"
 	"tagesTest/internal/service"
-	"tagesTest/pkg/limiter"
+	"tagesTest/internal/webhook"
 	pb "tagesTest/proto"
 )
 
-const uploadBufferSize = 100
-
 type FileServiceHandler struct {
 	pb.UnimplementedFileServiceServer
 	service          *service.FileService
-	uploadLimiter    *limiter.Limiter
-	downloadLimiter  *limiter.Limiter
-	listLimiter      *limiter.Limiter
-	storageDir       string
-	filename         string
+	buckets          *service.Buckets
+	policy           *policy.Policy
+	webhooks         *webhook.Dispatcher
+	uploadTimeout    time.Duration
+	chunkSize        int
 	uploadBufferSize int
-	errChan          chan error
+	// stopping is closed on shutdown to end calls that never finish on
+	// their own, like WatchFiles
+	stopping chan struct{}
+	stopOnce sync.Once
 }
 
-func NewFileServiceHandler(service *service.FileService, storageDir string) *FileServiceHandler {
+func NewFileServiceHandler(
+	buckets *service.Buckets, pol *policy.Policy, webhooks *webhook.Dispatcher, cfg *config.Config,
+) *FileServiceHandler {
 	return &FileServiceHandler{
-		service:          service,
-		uploadLimiter:    limiter.NewLimiter(10),
-		downloadLimiter:  limiter.NewLimiter(10),
-		listLimiter:      limiter.NewLimiter(100),
-		storageDir:       storageDir,
-		uploadBufferSize: uploadBufferSize,
+		service:          buckets.Default(),
+		buckets:          buckets,
+		policy:           pol,
+		webhooks:         webhooks,
+		uploadTimeout:    cfg.UploadTimeout,
+		chunkSize:        cfg.ChunkSize,
+		uploadBufferSize: cfg.UploadBufferSize,
+		stopping:         make(chan struct{}),
 	}
 }
 
-func (h *FileServiceHandler) UploadFile(stream pb.FileService_UploadFileServer) error {
-	log.Println("Starting file upload process")
+func (h *FileServiceHandler) stop() {
+	h.stopOnce.Do(func() { close(h.stopping) })
+}
 
-	ctx, cancel := context.WithTimeout(stream.Context(), 30*time.Second)
+func (h *FileServiceHandler) UploadFile(stream pb.FileService_UploadFileServer) error {
+	ctx, cancel := context.WithTimeout(stream.Context(), h.uploadTimeout)
 	defer cancel()
 
-	if err := h.uploadLimiter.Acquire(ctx); err != nil {
-		log.Println("uploaders limit reached")
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
 		return status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
 	}
-	defer h.uploadLimiter.Release()
+	defer release()
 
-	if err := os.MkdirAll(filepath.Dir(h.storageDir), 0755); err != nil {
-		log.Printf("failed to create directory: %v", err)
-		return status.Errorf(codes.Internal, "failed to create directory: %v", err)
+	req, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to receive file info: %v", err)
+	}
+	filename := req.Filename
+	if filename == "" {
+		filename = filepath.Base(req.GetImagePath())
 	}
-	var (
-		filename  string
-		totalSize int64
-	)
+	logger.AddAttrs(ctx, slog.String("filename", filename))
+	if !h.policy.IsImage(filename) {
+		return status.Errorf(codes.InvalidArgument, "not an image")
+	}
+	files, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return err
+	}
+	bucket := files.Bucket()
+	if !bucket.Allows(filename) {
+		return status.Errorf(codes.InvalidArgument, "file type not allowed in bucket %s", bucket.Name)
+	}
+
+	opts, err := writeOptions(req)
+	if err != nil {
+		return err
+	}
+	opts.Retention = h.policy.VersionRetention()
+	opts.Owner = clientIdentity(ctx)
+	opts.Quotas = h.policy.Quotas(bucket, opts.Owner)
 
 	dataChan := make(chan []byte, h.uploadBufferSize)
 	errChan := make(chan error, 1)
+	go h.receivingLoop(ctx, dataChan, errChan, func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetChunk(), err
+	})
 
-	req, err := stream.Recv()
-	if err == io.EOF {
-		log.Println("received EOF in goroutine")
+	chunks := &chunkReader{ctx: ctx, dataChan: dataChan, errChan: errChan}
+	body := h.policy.BucketReader(bucket, h.policy.UploadReader(ctx, opts.Owner, chunks))
+	saved, err := files.WriteFile(filename, body, opts)
+	if err != nil {
+		return toStatus(err, "failed to upload file")
 	}
-	h.filename = filepath.Base(req.GetImagePath())
-	filePath := fmt.Sprintf("%s/%s", h.storageDir, h.filename)
 
-	// check if file already exists
-	if _, err := os.Stat(filePath); err == nil {
-		return status.Errorf(codes.AlreadyExists, "file already exists")
-	}
+	logger.AddAttrs(ctx, slog.Int64("bytes", saved.Size), slog.Int64("version", saved.Version))
+	return stream.SendAndClose(&pb.UploadFileResponse{
+		Message:  fmt.Sprintf("File uploaded successfully. Size: %d bytes", saved.Size),
+		Size:     uint32(saved.Size),
+		Version:  saved.Version,
+		Checksum: saved.Checksum,
+	})
+}
 
-	file, err := os.Create(filePath)
+// writeOptions reads the write mode of an upload from its first message.
+func writeOptions(req *pb.UploadFileRequest) (domain.WriteOptions, error) {
+	if req.TtlSeconds < 0 {
+		return domain.WriteOptions{}, status.Errorf(codes.InvalidArgument, "ttl_seconds must not be negative")
+	}
+	opts, err := targetOptions(req.WriteMode, req.IfGeneration, req.IfChecksum)
 	if err != nil {
-		log.Printf("failed to create file: %v", err)
-		return status.Errorf(codes.Internal, "failed to create file: %v", err)
+		return opts, err
 	}
-	defer file.Close()
+	if req.NewVersion && opts.Mode == domain.WriteCreateOnly {
+		opts.Mode = domain.WriteOverwrite
+	}
+	opts.KeepVersion = req.NewVersion
+	opts.TTL = time.Duration(req.TtlSeconds) * time.Second
+	if len(req.Metadata) > 0 {
+		opts.Metadata = req.Metadata
+	}
+	if len(req.Tags) > 0 {
+		opts.Tags = req.Tags
+	}
+	return opts, nil
+}
 
-	go h.receivingLoop(ctx, dataChan, stream)
-	for {
-		select {
-		case chunk, ok := <-dataChan:
-			if !ok {
-				if totalSize == 0 {
-					log.Println("No file data received")
-					return status.Error(codes.InvalidArgument, "No file data received")
-				}
-				log.Printf("File %s uploaded successfully, size: %d bytes", filename, totalSize)
-				return stream.SendAndClose(&pb.UploadFileResponse{
-					Message: fmt.Sprintf("File uploaded successfully. Size: %d bytes", totalSize),
-				})
-			}
-			n, err := file.Write(chunk)
-			if err != nil {
-				log.Printf("Failed to write chunk: %v", err)
-				return status.Errorf(codes.Internal, "Failed to write chunk: %v", err)
-			}
-			totalSize += int64(n)
-			log.Printf("Received chunk, total data size: %d bytes", totalSize)
-		case err := <-errChan:
-			return status.Errorf(codes.Internal, "Error receiving file: %v", err)
+// targetOptions reads what a write does when its target file exists.
+func targetOptions(mode pb.WriteMode, ifGeneration int64, ifChecksum string) (domain.WriteOptions, error) {
+	opts := domain.WriteOptions{IfGeneration: ifGeneration, IfChecksum: ifChecksum}
+	switch mode {
+	case pb.WriteMode_WRITE_MODE_CREATE_ONLY:
+		opts.Mode = domain.WriteCreateOnly
+	case pb.WriteMode_WRITE_MODE_OVERWRITE:
+		opts.Mode = domain.WriteOverwrite
+	case pb.WriteMode_WRITE_MODE_OVERWRITE_IF_MATCH:
+		opts.Mode = domain.WriteOverwriteIfMatch
+		if ifGeneration <= 0 && ifChecksum == "" {
+			return opts, status.Errorf(codes.InvalidArgument, "if_generation or if_checksum is required")
 		}
+	default:
+		return opts, status.Errorf(codes.InvalidArgument, "unknown write mode %v", mode)
 	}
+	return opts, nil
 }
 
+// receivingLoop feeds chunks returned by recv into dataChan until the client
+// closes the stream.
 func (h *FileServiceHandler) receivingLoop(
-	ctx context.Context, dataChan chan []byte, stream pb.FileService_UploadFileServer,
+	ctx context.Context, dataChan chan []byte, errChan chan error, recv func() ([]byte, error),
 ) {
 
 	defer close(dataChan)
@@ -121,82 +174,122 @@ func (h *FileServiceHandler) receivingLoop(
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Context done, stopping receive loop")
+			logger.FromContext(ctx).Debug("context done, stopping receive loop")
 			return
 		default:
-			req, err := stream.Recv()
+			chunk, err := recv()
 			if err == io.EOF {
-				log.Println("received EOF in goroutine")
 				return
 			}
 			if err != nil {
-				log.Printf("error receiving chunk in goroutine: %v", err)
-				h.errChan <- err
+				errChan <- err
 				return
 			}
-			chunk := req.GetChunk()
-			size := len(chunk)
-			log.Printf("received a chunk with size: %d", size)
-			dataChan <- chunk
+			logger.FromContext(ctx).Debug("received chunk", slog.Int("size", len(chunk)))
+			select {
+			case dataChan <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// chunkReader exposes the chunks collected by receivingLoop as an io.Reader.
+type chunkReader struct {
+	ctx      context.Context
+	dataChan chan []byte
+	errChan  chan error
+	pending  []byte
+}
+
+func (r *chunkReader) Read(buf []byte) (int, error) {
+	for len(r.pending) == 0 {
+		chunk, ok := <-r.dataChan
+		if !ok {
+			// the receiving loop reports failures before closing dataChan
+			select {
+			case err := <-r.errChan:
+				return 0, err
+			default:
+			}
+			if err := r.ctx.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
 		}
+		r.pending = chunk
 	}
+	n := copy(buf, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
 }
 
 func (h *FileServiceHandler) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
-	if err := h.listLimiter.Acquire(ctx); err != nil {
+	release, err := h.policy.Acquire(ctx, policy.List)
+	if err != nil {
 		return nil, status.Errorf(codes.ResourceExhausted, "list limit reached")
 	}
-	defer h.listLimiter.Release()
+	defer release()
 
-	files, err := h.service.ListFiles()
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	filter := domain.FileFilter{Tags: req.Tags, Metadata: req.Metadata}
+	files, prefixes, err := bucket.ListFolder(req.Prefix, req.Delimiter, filter)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to list files: %v", err)
 	}
 
+	logger.AddAttrs(ctx, slog.Int("files", len(files)), slog.Int("prefixes", len(prefixes)))
+
 	var pbFiles []*pb.FileInfo
 	for _, file := range files {
 		pbFiles = append(pbFiles, &pb.FileInfo{
 			Filename:  file.Filename,
 			CreatedAt: file.CreatedAt.Format(time.RFC3339),
 			UpdatedAt: file.UpdatedAt.Format(time.RFC3339),
+			Size:      uint64(file.Size),
+			Metadata:  file.Attributes.Metadata,
+			Tags:      file.Attributes.Tags,
 		})
 	}
 
-	return &pb.ListFilesResponse{Files: pbFiles}, nil
+	return &pb.ListFilesResponse{Files: pbFiles, CommonPrefixes: prefixes}, nil
 }
 
 func (h *FileServiceHandler) DownloadFile(req *pb.DownloadFileRequest, stream pb.FileService_DownloadFileServer) error {
-	if err := h.downloadLimiter.Acquire(stream.Context()); err != nil {
+	ctx := stream.Context()
+	release, err := h.policy.Acquire(ctx, policy.Download)
+	if err != nil {
 		return status.Errorf(codes.ResourceExhausted, "download limit reached")
 	}
-	defer h.downloadLimiter.Release()
+	defer release()
 
-	if !isImage(req.Filename) {
-		return status.Errorf(codes.InvalidArgument, "not an image")
-	}
-
-	sourcePath := filepath.Join(h.storageDir, req.Filename)
-	sourceFile, err := h.service.DownloadFile(sourcePath)
+	filename, sourceFile, err := h.openDownload(ctx, req)
 	if err != nil {
-		return status.Errorf(codes.NotFound, "file not found: %v", err)
+		return err
 	}
 	defer sourceFile.Close()
 
-	destPath := filepath.Join("downloads", "downloaded_"+req.Filename)
+	destPath := filepath.Join("downloads", "downloaded_"+path.Base(filename))
 	destFile, err := os.Create(destPath)
 	if err != nil {
 		return status.Errorf(codes.Internal, "failed to create destination file: %v", err)
 	}
 	defer destFile.Close()
 
-	buffer := make([]byte, 1024)
+	source := h.policy.DownloadReader(ctx, clientIdentity(ctx), sourceFile)
+	var totalSize int64
+	buffer := make([]byte, h.chunkSize)
 	for {
-		n, err := sourceFile.Read(buffer)
+		n, err := source.Read(buffer)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return status.Errorf(codes.Internal, "failed to read file: %v", err)
+			return toStatus(err, "failed to read file")
 		}
 
 		_, err = destFile.Write(buffer[:n])
@@ -207,17 +300,133 @@ func (h *FileServiceHandler) DownloadFile(req *pb.DownloadFileRequest, stream pb
 		if err := stream.Send(&pb.DownloadFileResponse{Chunk: buffer[:n]}); err != nil {
 			return status.Errorf(codes.Internal, "failed to send chunk: %v", err)
 		}
+		totalSize += int64(n)
 	}
 
+	logger.AddAttrs(ctx, slog.Int64("bytes", totalSize))
 	return nil
 }
 
-func isImage(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif", ".bmp":
-		return true
+// openDownload opens the requested file, either by name or through a share
+// link, and returns its name.
+func (h *FileServiceHandler) openDownload(ctx context.Context, req *pb.DownloadFileRequest) (string, io.ReadCloser, error) {
+	if req.ShareToken != "" {
+		link, file, err := h.buckets.OpenShareLink(req.ShareToken)
+		if err != nil {
+			return "", nil, toStatus(err, "failed to open share link")
+		}
+		logger.AddAttrs(ctx, slog.String("filename", link.Filename), slog.String("share_link", link.ID))
+		return link.Filename, file, nil
+	}
+
+	logger.AddAttrs(ctx, slog.String("filename", req.Filename))
+	if !h.policy.IsImage(req.Filename) {
+		return "", nil, status.Errorf(codes.InvalidArgument, "not an image")
+	}
+	if req.Version < 0 {
+		return "", nil, status.Errorf(codes.InvalidArgument, "version must not be negative")
+	}
+	if req.Version != 0 {
+		logger.AddAttrs(ctx, slog.Int64("version", req.Version))
+	}
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return "", nil, err
+	}
+	file, err := bucket.DownloadFileVersion(req.Filename, req.Version)
+	if err != nil {
+		return "", nil, toStatus(err, "failed to open file")
+	}
+	return req.Filename, file, nil
+}
+
+func (h *FileServiceHandler) CreateShareLink(
+	ctx context.Context, req *pb.CreateShareLinkRequest,
+) (*pb.CreateShareLinkResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Metadata)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "metadata limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("filename", req.Filename))
+	expiresAt, err := h.policy.ShareLinkExpiry(time.Now(), time.Duration(req.TtlSeconds)*time.Second)
+	if err != nil {
+		return nil, toStatus(err, "failed to create share link")
+	}
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	link, token, err := bucket.CreateShareLink(req.Filename, expiresAt, int(req.MaxDownloads))
+	if err != nil {
+		return nil, toStatus(err, "failed to create share link")
+	}
+
+	logger.AddAttrs(ctx, slog.String("share_link", link.ID))
+	return &pb.CreateShareLinkResponse{
+		Id:        link.ID,
+		Token:     token,
+		Url:       h.policy.ShareLinkURL(token),
+		ExpiresAt: link.ExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+func (h *FileServiceHandler) RevokeShareLink(
+	ctx context.Context, req *pb.RevokeShareLinkRequest,
+) (*pb.RevokeShareLinkResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Metadata)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "metadata limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("share_link", req.Id))
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if err := bucket.RevokeShareLink(req.Id); err != nil {
+		return nil, toStatus(err, "failed to revoke share link")
+	}
+	return &pb.RevokeShareLinkResponse{}, nil
+}
+
+// toStatus maps service and policy errors to gRPC status codes.
+func toStatus(err error, msg string) error {
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound), errors.Is(err, domain.ErrVersionNotFound),
+		errors.Is(err, domain.ErrTrashEntryNotFound), errors.Is(err, domain.ErrShareLinkNotFound),
+		errors.Is(err, domain.ErrBucketNotFound), errors.Is(err, domain.ErrFolderNotFound):
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	case errors.Is(err, domain.ErrFileExists), errors.Is(err, domain.ErrBucketExists):
+		return status.Errorf(codes.AlreadyExists, "%s: %v", msg, err)
+	case errors.Is(err, domain.ErrPreconditionFailed), errors.Is(err, domain.ErrBucketNotEmpty),
+		errors.Is(err, domain.ErrFolderNotEmpty):
+		return status.Errorf(codes.FailedPrecondition, "%s: %v", msg, err)
+	case errors.Is(err, domain.ErrInvalidFilename), errors.Is(err, domain.ErrInvalidBucketName),
+		errors.Is(err, domain.ErrInvalidMetadata), errors.Is(err, domain.ErrInvalidSearch),
+		errors.Is(err, policy.ErrTooLarge), errors.Is(err, policy.ErrEmptyFile),
+		errors.Is(err, policy.ErrLinkTTL), errors.Is(err, archive.ErrInvalid),
+		errors.Is(err, archive.ErrTooManyEntries), errors.Is(err, archive.ErrTooLarge):
+		return status.Errorf(codes.InvalidArgument, "%s: %v", msg, err)
+	case errors.Is(err, domain.ErrShareLinkInvalid), errors.Is(err, domain.ErrShareLinkExpired),
+		errors.Is(err, domain.ErrShareLinkRevoked), errors.Is(err, domain.ErrShareLinkExhausted),
+		errors.Is(err, domain.ErrNotOwner):
+		return status.Errorf(codes.PermissionDenied, "%s: %v", msg, err)
+	case errors.Is(err, events.ErrSequenceUnavailable):
+		return status.Errorf(codes.OutOfRange, "%s: %v", msg, err)
+	case errors.Is(err, domain.ErrQuotaExceeded), errors.Is(err, events.ErrTooManySubscribers),
+		errors.Is(err, events.ErrSlowSubscriber):
+		return status.Errorf(codes.ResourceExhausted, "%s: %v", msg, err)
+	case errors.Is(err, events.ErrClosed):
+		return status.Errorf(codes.Unavailable, "%s: %v", msg, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
 	default:
-		return false
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
 	}
 }
@@ -0,0 +1,84 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"tagesTest/internal/service"
+	pb "tagesTest/proto"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// healthMonitor periodically checks the storage of every bucket and reports
+// the result through the standard grpc.health.v1 service, both for
+// FileService and for the server as a whole.
+type healthMonitor struct {
+	health   *health.Server
+	buckets  *service.Buckets
+	interval time.Duration
+	logger   *slog.Logger
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func newHealthMonitor(
+	healthServer *health.Server, buckets *service.Buckets, interval time.Duration, logger *slog.Logger,
+) *healthMonitor {
+	return &healthMonitor{
+		health:   healthServer,
+		buckets:  buckets,
+		interval: interval,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+}
+
+func (m *healthMonitor) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.check(ctx)
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.check(ctx)
+			}
+		}
+	}()
+}
+
+func (m *healthMonitor) stop() {
+	m.cancel()
+	<-m.done
+}
+
+func (m *healthMonitor) check(ctx context.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	servingStatus := healthpb.HealthCheckResponse_SERVING
+	for _, files := range m.buckets.All() {
+		if err := files.HealthCheck(checkCtx); err != nil {
+			if ctx.Err() != nil {
+				// the monitor is stopping, keep the last status
+				return
+			}
+			m.logger.Warn("storage health check failed",
+				slog.String("bucket", files.Bucket().Name), slog.Any("error", err))
+			servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+			break
+		}
+	}
+	m.health.SetServingStatus(pb.FileService_ServiceDesc.ServiceName, servingStatus)
+	m.health.SetServingStatus("", servingStatus)
+}
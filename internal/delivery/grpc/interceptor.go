@@ -0,0 +1,84 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/logger"
+)
+
+const requestIDHeader = "x-request-id"
+
+func UnaryLoggingInterceptor(base *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = newCallContext(ctx, base, info.FullMethod)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, start, err)
+		return resp, err
+	}
+}
+
+func StreamLoggingInterceptor(base *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := newCallContext(ss.Context(), base, info.FullMethod)
+		start := time.Now()
+		err := handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+		logCall(ctx, start, err)
+		return err
+	}
+}
+
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
+}
+
+func newCallContext(ctx context.Context, base *slog.Logger, method string) context.Context {
+	requestID := logger.RequestID(requestIDFromMetadata(ctx))
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, requestID))
+
+	l := base.With(slog.String("request_id", requestID), slog.String("method", method))
+	return logger.WithLogger(ctx, l)
+}
+
+func logCall(ctx context.Context, start time.Time, err error) {
+	code := status.Code(err)
+	attrs := append([]slog.Attr{
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	}, logger.Attrs(ctx)...)
+
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+	logger.FromContext(ctx).LogAttrs(ctx, level, "rpc finished", attrs...)
+}
+
+func requestIDFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(requestIDHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
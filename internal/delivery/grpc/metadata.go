@@ -0,0 +1,39 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+	pb "tagesTest/proto"
+)
+
+func (h *FileServiceHandler) UpdateMetadata(
+	ctx context.Context, req *pb.UpdateMetadataRequest,
+) (*pb.UpdateMetadataResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Metadata)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "metadata limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("filename", req.Filename))
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := bucket.UpdateMetadata(req.Filename, domain.AttributesUpdate{
+		SetMetadata:    req.SetMetadata,
+		RemoveMetadata: req.RemoveMetadata,
+		AddTags:        req.AddTags,
+		RemoveTags:     req.RemoveTags,
+	})
+	if err != nil {
+		return nil, toStatus(err, "failed to update metadata")
+	}
+	return &pb.UpdateMetadataResponse{Metadata: attributes.Metadata, Tags: attributes.Tags}, nil
+}
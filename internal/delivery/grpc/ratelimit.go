@@ -0,0 +1,120 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/logger"
+	"tagesTest/pkg/limiter"
+	pb "tagesTest/proto"
+)
+
+const retryAfterTrailer = "retry-after"
+
+// methodOperations maps rate limited methods to the policy budget they use.
+var methodOperations = map[string]policy.Operation{
+	pb.FileService_UploadFile_FullMethodName:       policy.Upload,
+	pb.FileService_UploadArchive_FullMethodName:    policy.Upload,
+	pb.FileService_DownloadFile_FullMethodName:     policy.Download,
+	pb.FileService_DownloadArchive_FullMethodName:  policy.Download,
+	pb.FileService_ListFiles_FullMethodName:        policy.List,
+	pb.FileService_GetWebhookStatus_FullMethodName: policy.List,
+	pb.FileService_ListFileVersions_FullMethodName: policy.List,
+	pb.FileService_ListTrash_FullMethodName:        policy.List,
+	pb.FileService_GetUsage_FullMethodName:         policy.List,
+	pb.FileService_ListBuckets_FullMethodName:      policy.List,
+	pb.FileService_SearchFiles_FullMethodName:      policy.List,
+	pb.FileService_WatchFiles_FullMethodName:       policy.Watch,
+	pb.FileService_CreateShareLink_FullMethodName:  policy.Metadata,
+	pb.FileService_RevokeShareLink_FullMethodName:  policy.Metadata,
+	pb.FileService_UpdateMetadata_FullMethodName:   policy.Metadata,
+	// deletes, trash, version, bucket, folder, rename and copy changes are
+	// writes and share the upload budget
+	pb.FileService_DeleteFile_FullMethodName:        policy.Upload,
+	pb.FileService_RestoreFile_FullMethodName:       policy.Upload,
+	pb.FileService_PurgeTrash_FullMethodName:        policy.Upload,
+	pb.FileService_PruneFileVersions_FullMethodName: policy.Upload,
+	pb.FileService_CreateBucket_FullMethodName:      policy.Upload,
+	pb.FileService_DeleteBucket_FullMethodName:      policy.Upload,
+	pb.FileService_CreateFolder_FullMethodName:      policy.Upload,
+	pb.FileService_MoveFolder_FullMethodName:        policy.Upload,
+	pb.FileService_DeleteFolder_FullMethodName:      policy.Upload,
+	pb.FileService_RenameFile_FullMethodName:        policy.Upload,
+	pb.FileService_CopyFile_FullMethodName:          policy.Upload,
+}
+
+func UnaryLimitInterceptor(pol *policy.Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		release, trailer, err := acquireClient(ctx, pol, info.FullMethod)
+		if err != nil {
+			_ = grpc.SetTrailer(ctx, trailer)
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+func StreamLimitInterceptor(pol *policy.Policy) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		release, trailer, err := acquireClient(ss.Context(), pol, info.FullMethod)
+		if err != nil {
+			ss.SetTrailer(trailer)
+			return err
+		}
+		defer release()
+		return handler(srv, ss)
+	}
+}
+
+func acquireClient(ctx context.Context, pol *policy.Policy, method string) (func(), metadata.MD, error) {
+	op, ok := methodOperations[method]
+	if !ok {
+		return func() {}, nil, nil
+	}
+
+	client := clientIdentity(ctx)
+	logger.AddAttrs(ctx, slog.String("client", client))
+
+	release, err := pol.AcquireClient(op, client)
+	if err == nil {
+		return release, nil, nil
+	}
+
+	var limitErr *limiter.LimitError
+	if !errors.As(err, &limitErr) {
+		return nil, nil, status.Errorf(codes.Internal, "rate limiter failure: %v", err)
+	}
+	trailer := metadata.Pairs(retryAfterTrailer, strconv.Itoa(limitErr.RetryAfterSeconds()))
+	return nil, trailer, status.Errorf(codes.ResourceExhausted, "%s", limitErr.Error())
+}
+
+// clientIdentity returns the verified TLS client certificate subject if there
+// is one, otherwise the peer IP address.
+func clientIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		chains := tlsInfo.State.VerifiedChains
+		if len(chains) > 0 && len(chains[0]) > 0 {
+			return "cn:" + chains[0][0].Subject.CommonName
+		}
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,89 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/logger"
+	"tagesTest/internal/service"
+	pb "tagesTest/proto"
+)
+
+func (h *FileServiceHandler) RenameFile(ctx context.Context, req *pb.RenameFileRequest) (*pb.RenameFileResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("filename", req.From), slog.String("to", req.To))
+	bucket, err := h.target(ctx, req.Bucket, req.To)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := targetOptions(req.WriteMode, req.IfGeneration, req.IfChecksum)
+	if err != nil {
+		return nil, err
+	}
+	// only the owner of a file may move it
+	opts.Owner = clientIdentity(ctx)
+	renamed, err := bucket.RenameFile(req.From, req.To, opts)
+	if err != nil {
+		return nil, toStatus(err, "failed to rename file")
+	}
+	return &pb.RenameFileResponse{
+		Version:  renamed.Version,
+		Size:     uint32(renamed.Size),
+		Checksum: renamed.Checksum,
+	}, nil
+}
+
+func (h *FileServiceHandler) CopyFile(ctx context.Context, req *pb.CopyFileRequest) (*pb.CopyFileResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("filename", req.From), slog.String("to", req.To))
+	bucket, err := h.target(ctx, req.Bucket, req.To)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := targetOptions(req.WriteMode, req.IfGeneration, req.IfChecksum)
+	if err != nil {
+		return nil, err
+	}
+	opts.Owner = clientIdentity(ctx)
+	opts.Quotas = h.policy.Quotas(bucket.Bucket(), opts.Owner)
+
+	copied, err := bucket.CopyFile(req.From, req.To, opts)
+	if err != nil {
+		return nil, toStatus(err, "failed to copy file")
+	}
+	logger.AddAttrs(ctx, slog.Int64("bytes", copied.Size))
+	return &pb.CopyFileResponse{
+		Version:  copied.Version,
+		Size:     uint32(copied.Size),
+		Checksum: copied.Checksum,
+	}, nil
+}
+
+// target returns the service of bucket once filename passes the checks an
+// upload of it would.
+func (h *FileServiceHandler) target(ctx context.Context, bucket, filename string) (*service.FileService, error) {
+	if !h.policy.IsImage(filename) {
+		return nil, status.Errorf(codes.InvalidArgument, "not an image")
+	}
+	files, err := h.bucket(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if b := files.Bucket(); !b.Allows(filename) {
+		return nil, status.Errorf(codes.InvalidArgument, "file type not allowed in bucket %s", b.Name)
+	}
+	return files, nil
+}
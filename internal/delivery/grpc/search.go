@@ -0,0 +1,83 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+	pb "tagesTest/proto"
+)
+
+func (h *FileServiceHandler) SearchFiles(ctx context.Context, req *pb.SearchFilesRequest) (*pb.SearchFilesResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.List)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "list limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("query", req.Name))
+	query := domain.SearchQuery{
+		Name:      req.Name,
+		Fuzzy:     req.Fuzzy,
+		Prefix:    req.Prefix,
+		Tags:      req.Tags,
+		Metadata:  req.Metadata,
+		MinSize:   int64(req.MinSize),
+		MaxSize:   int64(req.MaxSize),
+		MinWidth:  int(req.MinWidth),
+		MaxWidth:  int(req.MaxWidth),
+		MinHeight: int(req.MinHeight),
+		MaxHeight: int(req.MaxHeight),
+	}
+	for _, bound := range []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{
+		{"created_after", req.CreatedAfter, &query.CreatedAfter},
+		{"created_before", req.CreatedBefore, &query.CreatedBefore},
+		{"updated_after", req.UpdatedAfter, &query.UpdatedAfter},
+		{"updated_before", req.UpdatedBefore, &query.UpdatedBefore},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		if *bound.dst, err = time.Parse(time.RFC3339, bound.value); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %v", bound.name, err)
+		}
+	}
+
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	results, next, total, err := bucket.SearchFiles(query, req.PageToken, int(req.PageSize))
+	if err != nil {
+		return nil, toStatus(err, "failed to search files")
+	}
+
+	logger.AddAttrs(ctx, slog.Int("files", len(results)), slog.Int("total", total))
+	resp := &pb.SearchFilesResponse{NextPageToken: next, Total: uint32(total)}
+	for _, result := range results {
+		file := result.File
+		resp.Results = append(resp.Results, &pb.SearchResult{
+			File: &pb.FileInfo{
+				Filename:  file.Filename,
+				CreatedAt: file.CreatedAt.Format(time.RFC3339),
+				UpdatedAt: file.UpdatedAt.Format(time.RFC3339),
+				Size:      uint64(file.Size),
+				Metadata:  file.Attributes.Metadata,
+				Tags:      file.Attributes.Tags,
+			},
+			Score:  result.Score,
+			Width:  uint32(result.Version.Width),
+			Height: uint32(result.Version.Height),
+		})
+	}
+	return resp, nil
+}
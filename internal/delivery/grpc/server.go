@@ -1,31 +1,76 @@
 package grpc
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"tagesTest/internal/config"
+	"tagesTest/internal/delivery/certs"
+	"tagesTest/internal/delivery/policy"
 	"tagesTest/internal/service"
+	"tagesTest/internal/webhook"
 	pb "tagesTest/proto"
 )
 
+var ErrForcedShutdown = errors.New("drain timeout exceeded, remaining calls were cancelled")
+
 type Server struct {
-	listener net.Listener
-	server   *grpc.Server
+	listener   net.Listener
+	server     *grpc.Server
+	health     *health.Server
+	monitor    *healthMonitor
+	handler    *FileServiceHandler
+	drainDelay time.Duration
 }
 
-func NewServer(address string, fileService *service.FileService, storageDir string) (*Server, error) {
-	listener, err := net.Listen("tcp", address)
+// NewServer creates the gRPC server. reloader may be nil when TLS is disabled.
+func NewServer(
+	cfg *config.Config, buckets *service.Buckets, pol *policy.Policy, webhooks *webhook.Dispatcher,
+	reloader *certs.Reloader, logger *slog.Logger,
+) (*Server, error) {
+	opts := []grpc.ServerOption{
+		// let Stop wait for cancelled handlers to roll back their uploads
+		grpc.WaitForHandlers(true),
+		grpc.ChainUnaryInterceptor(UnaryLoggingInterceptor(logger), UnaryLimitInterceptor(pol)),
+		grpc.ChainStreamInterceptor(StreamLoggingInterceptor(logger), StreamLimitInterceptor(pol)),
+	}
+	if reloader != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig())))
+	}
+
+	listener, err := net.Listen("tcp", cfg.ServerAddress)
 	if err != nil {
 		return nil, err
 	}
 
-	server := grpc.NewServer()
-	handler := NewFileServiceHandler(fileService, storageDir)
+	server := grpc.NewServer(opts...)
+	handler := NewFileServiceHandler(buckets, pol, webhooks, cfg)
 	pb.RegisterFileServiceServer(server, handler)
 
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	monitor := newHealthMonitor(healthServer, buckets, cfg.HealthInterval, logger)
+
+	if cfg.Reflection {
+		reflection.Register(server)
+	}
+	monitor.start()
+
 	return &Server{
-		listener: listener,
-		server:   server,
+		listener:   listener,
+		server:     server,
+		health:     healthServer,
+		monitor:    monitor,
+		handler:    handler,
+		drainDelay: cfg.DrainDelay,
 	}, nil
 }
 
@@ -33,6 +78,31 @@ func (s *Server) Start() error {
 	return s.server.Serve(s.listener)
 }
 
-func (s *Server) Stop() {
-	s.server.GracefulStop()
+// Stop reports NOT_SERVING to health checks, keeps serving for the drain
+// delay so that load balancers notice, and then waits for in-flight calls to
+// finish. Calls still running when ctx is done are cancelled, which rolls
+// back their partial uploads, and ErrForcedShutdown is returned.
+func (s *Server) Stop(ctx context.Context) error {
+	s.monitor.stop()
+	s.health.Shutdown()
+	select {
+	case <-time.After(s.drainDelay):
+	case <-ctx.Done():
+	}
+	s.handler.stop()
+
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		<-done
+		return ErrForcedShutdown
+	}
 }
@@ -0,0 +1,111 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/logger"
+	pb "tagesTest/proto"
+)
+
+func (h *FileServiceHandler) DeleteFile(ctx context.Context, req *pb.DeleteFileRequest) (*pb.DeleteFileResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("filename", req.Filename))
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := bucket.DeleteFile(req.Filename, h.policy.TrashRetention())
+	if err != nil {
+		return nil, toStatus(err, "failed to delete file")
+	}
+	if entry.ID == "" {
+		return &pb.DeleteFileResponse{}, nil
+	}
+	logger.AddAttrs(ctx, slog.String("trash_id", entry.ID))
+	return &pb.DeleteFileResponse{TrashId: entry.ID, ExpiresAt: entry.ExpiresAt.Format(time.RFC3339)}, nil
+}
+
+func (h *FileServiceHandler) ListTrash(ctx context.Context, req *pb.ListTrashRequest) (*pb.ListTrashResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.List)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "list limit reached")
+	}
+	defer release()
+
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	entries := bucket.ListTrash()
+	logger.AddAttrs(ctx, slog.Int("entries", len(entries)))
+
+	resp := &pb.ListTrashResponse{}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, &pb.TrashEntry{
+			Id:        entry.ID,
+			Filename:  entry.Filename,
+			Size:      uint64(entry.Size),
+			DeletedAt: entry.DeletedAt.Format(time.RFC3339),
+			ExpiresAt: entry.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+	return resp, nil
+}
+
+func (h *FileServiceHandler) RestoreFile(ctx context.Context, req *pb.RestoreFileRequest) (*pb.RestoreFileResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("trash_id", req.Id))
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := bucket.RestoreFile(req.Id)
+	if err != nil {
+		return nil, toStatus(err, "failed to restore file")
+	}
+	logger.AddAttrs(ctx, slog.String("filename", entry.Filename))
+	return &pb.RestoreFileResponse{Filename: entry.Filename}, nil
+}
+
+func (h *FileServiceHandler) PurgeTrash(ctx context.Context, req *pb.PurgeTrashRequest) (*pb.PurgeTrashResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	ids := req.Ids
+	if req.All {
+		if len(ids) > 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "ids and all are mutually exclusive")
+		}
+		for _, entry := range bucket.ListTrash() {
+			ids = append(ids, entry.ID)
+		}
+	}
+	purged, err := bucket.PurgeTrash(ids)
+	logger.AddAttrs(ctx, slog.Int("purged", purged))
+	if err != nil {
+		return nil, toStatus(err, "failed to purge trash")
+	}
+	return &pb.PurgeTrashResponse{Purged: uint32(purged)}, nil
+}
@@ -0,0 +1,49 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+	pb "tagesTest/proto"
+)
+
+func (h *FileServiceHandler) GetUsage(ctx context.Context, req *pb.GetUsageRequest) (*pb.GetUsageResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.List)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "list limit reached")
+	}
+	defer release()
+
+	owner := req.Owner
+	if owner == "" {
+		owner = clientIdentity(ctx)
+	}
+	logger.AddAttrs(ctx, slog.String("owner", owner))
+
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	usage, total := bucket.Usage(owner)
+	quotas := h.policy.Quotas(bucket.Bucket(), owner)
+	return &pb.GetUsageResponse{
+		Owner:  owner,
+		Usage:  toUsage(usage, quotas.Owner),
+		Global: toUsage(total, quotas.Global),
+		Bucket: toUsage(bucket.BucketUsage(), quotas.Bucket),
+	}, nil
+}
+
+func toUsage(usage domain.Usage, quota domain.Quota) *pb.Usage {
+	return &pb.Usage{
+		Bytes:    uint64(usage.Bytes),
+		Files:    uint64(usage.Files),
+		MaxBytes: uint64(quota.MaxBytes),
+		MaxFiles: uint64(quota.MaxFiles),
+	}
+}
@@ -0,0 +1,79 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/logger"
+	pb "tagesTest/proto"
+)
+
+func (h *FileServiceHandler) ListFileVersions(
+	ctx context.Context, req *pb.ListFileVersionsRequest,
+) (*pb.ListFileVersionsResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.List)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "list limit reached")
+	}
+	defer release()
+
+	logger.AddAttrs(ctx, slog.String("filename", req.Filename))
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := bucket.ListFileVersions(req.Filename)
+	if err != nil {
+		return nil, toStatus(err, "failed to list versions")
+	}
+
+	logger.AddAttrs(ctx, slog.Int("versions", len(versions)))
+	resp := &pb.ListFileVersionsResponse{}
+	for _, v := range versions {
+		resp.Versions = append(resp.Versions, &pb.FileVersion{
+			Version:   v.Version,
+			Size:      uint64(v.Size),
+			Checksum:  v.Checksum,
+			CreatedAt: v.CreatedAt.Format(time.RFC3339),
+			Latest:    v.Latest,
+		})
+	}
+	return resp, nil
+}
+
+func (h *FileServiceHandler) PruneFileVersions(
+	ctx context.Context, req *pb.PruneFileVersionsRequest,
+) (*pb.PruneFileVersionsResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.Upload)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "uploaders limit reached")
+	}
+	defer release()
+
+	if req.OlderThanSeconds < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "older_than_seconds must not be negative")
+	}
+	retention := h.policy.VersionRetention()
+	if req.KeepLast > 0 {
+		retention.KeepLast = int(req.KeepLast)
+	}
+	if req.OlderThanSeconds > 0 {
+		retention.MaxAge = time.Duration(req.OlderThanSeconds) * time.Second
+	}
+
+	logger.AddAttrs(ctx, slog.String("filename", req.Filename))
+	bucket, err := h.bucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := bucket.PruneVersions(req.Filename, retention)
+	logger.AddAttrs(ctx, slog.Int("removed", removed))
+	if err != nil {
+		return nil, toStatus(err, "failed to prune versions")
+	}
+	return &pb.PruneFileVersionsResponse{Removed: uint32(removed)}, nil
+}
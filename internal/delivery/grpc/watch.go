@@ -0,0 +1,111 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/events"
+	"tagesTest/internal/logger"
+	pb "tagesTest/proto"
+)
+
+// watchBuffer is the number of events a watcher may lag behind before it is
+// disconnected.
+const watchBuffer = 256
+
+var eventTypes = map[events.Type]pb.FileEventType{
+	events.Created:     pb.FileEventType_FILE_EVENT_TYPE_CREATED,
+	events.Updated:     pb.FileEventType_FILE_EVENT_TYPE_UPDATED,
+	events.Deleted:     pb.FileEventType_FILE_EVENT_TYPE_DELETED,
+	events.Expired:     pb.FileEventType_FILE_EVENT_TYPE_EXPIRED,
+	events.MovedToCold: pb.FileEventType_FILE_EVENT_TYPE_MOVED_TO_COLD,
+}
+
+// WatchFiles streams file changes until the client goes away. A client that
+// reconnects passes the epoch and sequence of the last event it saw to get
+// the events it missed; OutOfRange means they are gone, for instance after a
+// restart, and it has to resync with ListFiles.
+func (h *FileServiceHandler) WatchFiles(req *pb.WatchFilesRequest, stream pb.FileService_WatchFilesServer) error {
+	ctx := stream.Context()
+	// an unknown bucket fails instead of watching for events that never come
+	if _, err := h.bucket(ctx, req.Bucket); err != nil {
+		return err
+	}
+	sub, err := h.service.WatchFiles(req.Epoch, req.AfterSequence, watchBuffer)
+	if err != nil {
+		return toStatus(err, "failed to watch files")
+	}
+	defer sub.Close()
+
+	var sent int
+	defer func() { logger.AddAttrs(ctx, slog.Int("events", sent)) }()
+	for {
+		select {
+		case <-ctx.Done():
+			return toStatus(ctx.Err(), "watch cancelled")
+		case <-h.stopping:
+			return status.Errorf(codes.Unavailable, "server shutting down")
+		case <-sub.Done():
+			return toStatus(sub.Err(), "watch stopped")
+		case event := <-sub.Events():
+			if event.File.Bucket != req.Bucket || !strings.HasPrefix(event.File.Filename, req.Prefix) {
+				continue
+			}
+			err := stream.Send(&pb.FileEvent{
+				Sequence: event.Sequence,
+				Epoch:    event.Epoch,
+				Type:     eventTypes[event.Type],
+				File: &pb.FileInfo{
+					Filename:  event.File.Filename,
+					CreatedAt: event.File.CreatedAt.Format(time.RFC3339),
+					UpdatedAt: event.File.UpdatedAt.Format(time.RFC3339),
+					Size:      uint64(event.File.Size),
+				},
+				Time:   event.Time.Format(time.RFC3339Nano),
+				Bucket: event.File.Bucket,
+			})
+			if err != nil {
+				return err
+			}
+			sent++
+		}
+	}
+}
+
+func (h *FileServiceHandler) GetWebhookStatus(
+	ctx context.Context, req *pb.GetWebhookStatusRequest,
+) (*pb.GetWebhookStatusResponse, error) {
+	release, err := h.policy.Acquire(ctx, policy.List)
+	if err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "list limit reached")
+	}
+	defer release()
+
+	resp := &pb.GetWebhookStatusResponse{}
+	for _, st := range h.webhooks.Status() {
+		resp.Endpoints = append(resp.Endpoints, &pb.WebhookStatus{
+			Url:           st.URL,
+			Pending:       uint32(st.Pending),
+			Delivered:     uint64(st.Delivered),
+			Failed:        uint32(st.Failed),
+			Dropped:       uint64(st.Dropped),
+			LastError:     st.LastError,
+			LastAttempt:   formatTime(st.LastAttempt),
+			LastDelivered: formatTime(st.LastDelivered),
+		})
+	}
+	return resp, nil
+}
+
+// formatTime formats t as RFC 3339, leaving the zero time empty.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
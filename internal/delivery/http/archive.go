@@ -0,0 +1,65 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"tagesTest/internal/archive"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/logger"
+	"tagesTest/internal/service"
+)
+
+// downloadArchive streams the files given by repeated name parameters and/or
+// a prefix parameter as a zip or tar.gz archive built on the fly.
+func (h *FileHandler) downloadArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	release, ok := h.acquire(ctx, w, r, policy.Download)
+	if !ok {
+		return
+	}
+	defer release()
+
+	names, prefix := query["name"], query.Get("prefix")
+	if len(names) == 0 && prefix == "" {
+		writeError(w, http.StatusBadRequest, "name or prefix parameter required")
+		return
+	}
+	format, err := archive.ParseFormat(query.Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "files"+format.Extension()))
+	w.WriteHeader(http.StatusOK)
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		manifest, err := bucket.WriteArchive(ctx, pw, service.ArchiveRequest{
+			Filenames: names,
+			Prefix:    prefix,
+			Format:    format,
+			Accept:    h.policy.IsImage,
+		})
+		logger.AddAttrs(ctx, slog.Int("files", len(manifest.Files)), slog.Int("missing", len(manifest.Missing)))
+		pw.CloseWithError(err)
+	}()
+
+	n, err := io.Copy(w, h.policy.DownloadReader(ctx, clientIdentity(r), pr))
+	logger.AddAttrs(ctx, slog.Int64("bytes", n))
+	if err != nil {
+		// headers are already sent, all we can do is cut the response short
+		logger.AddAttrs(ctx, slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+	"tagesTest/internal/service"
+)
+
+// bucket mirrors the gRPC Bucket message.
+type bucket struct {
+	Name              string   `json:"name"`
+	CreatedAt         string   `json:"created_at"`
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+	MaxFileSize       int64    `json:"max_file_size,omitempty"`
+	MaxBytes          int64    `json:"max_bytes,omitempty"`
+	MaxFiles          int64    `json:"max_files,omitempty"`
+	Usage             *usage   `json:"usage,omitempty"`
+}
+
+type createBucketRequest struct {
+	AllowedExtensions []string `json:"allowed_extensions"`
+	MaxFileSize       int64    `json:"max_file_size"`
+	MaxBytes          int64    `json:"max_bytes"`
+	MaxFiles          int64    `json:"max_files"`
+}
+
+type listBucketsResponse struct {
+	Buckets []bucket `json:"buckets"`
+}
+
+func newBucket(b domain.Bucket) bucket {
+	return bucket{
+		Name:              b.Name,
+		CreatedAt:         b.CreatedAt.Format(time.RFC3339),
+		AllowedExtensions: b.AllowedExtensions,
+		MaxFileSize:       b.MaxFileSize,
+		MaxBytes:          b.Quota.MaxBytes,
+		MaxFiles:          b.Quota.MaxFiles,
+	}
+}
+
+// bucket returns the service of the bucket named by the bucket query
+// parameter, or of the default one without it. It writes the error response
+// if there is no such bucket.
+func (h *FileHandler) bucket(w http.ResponseWriter, r *http.Request) (*service.FileService, bool) {
+	name := r.URL.Query().Get("bucket")
+	if name != "" {
+		logger.AddAttrs(r.Context(), slog.String("bucket", name))
+	}
+	bucket, err := h.buckets.Get(name)
+	if err != nil {
+		writeServiceError(r.Context(), w, err, "failed to open bucket")
+		return nil, false
+	}
+	return bucket, true
+}
+
+func (h *FileHandler) createBucket(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := r.PathValue("bucket")
+	logger.AddAttrs(ctx, slog.String("bucket", name))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// the body is optional, an empty one creates a bucket without own limits
+	var req createBucketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if req.MaxFileSize < 0 || req.MaxBytes < 0 || req.MaxFiles < 0 {
+		writeError(w, http.StatusBadRequest, "limits must not be negative")
+		return
+	}
+
+	created, err := h.buckets.Create(domain.Bucket{
+		Name:              name,
+		AllowedExtensions: req.AllowedExtensions,
+		MaxFileSize:       req.MaxFileSize,
+		Quota:             domain.Quota{MaxBytes: req.MaxBytes, MaxFiles: req.MaxFiles},
+	})
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to create bucket")
+		return
+	}
+	writeJSON(w, http.StatusCreated, newBucket(created))
+}
+
+func (h *FileHandler) listBuckets(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	release, ok := h.acquire(ctx, w, r, policy.List)
+	if !ok {
+		return
+	}
+	defer release()
+
+	resp := listBucketsResponse{Buckets: []bucket{}}
+	for _, b := range h.buckets.List() {
+		files, err := h.buckets.Get(b.Name)
+		if err != nil {
+			// deleted meanwhile
+			continue
+		}
+		info := newBucket(b)
+		usage := newUsage(files.BucketUsage(), h.policy.Quotas(b, "").Bucket)
+		info.Usage = &usage
+		resp.Buckets = append(resp.Buckets, info)
+	}
+	logger.AddAttrs(ctx, slog.Int("buckets", len(resp.Buckets)))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *FileHandler) deleteBucket(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := r.PathValue("bucket")
+	logger.AddAttrs(ctx, slog.String("bucket", name))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var force bool
+	if v := r.URL.Query().Get("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid force")
+			return
+		}
+	}
+	if err := h.buckets.Delete(name, force); err != nil {
+		writeServiceError(ctx, w, err, "failed to delete bucket")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
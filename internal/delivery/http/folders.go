@@ -0,0 +1,102 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/logger"
+)
+
+type moveFolderResponse struct {
+	Moved int `json:"moved"`
+}
+
+type deleteFolderResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+func (h *FileHandler) createFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	folder := r.PathValue("path")
+	logger.AddAttrs(ctx, slog.String("folder", folder))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	if err := bucket.CreateFolder(folder); err != nil {
+		writeServiceError(ctx, w, err, "failed to create folder")
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// moveFolder moves the folder to the path given by the to query parameter.
+func (h *FileHandler) moveFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	folder := r.PathValue("path")
+	to := r.URL.Query().Get("to")
+	logger.AddAttrs(ctx, slog.String("folder", folder), slog.String("to", to))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if to == "" {
+		writeError(w, http.StatusBadRequest, "to is required")
+		return
+	}
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	moved, err := bucket.MoveFolder(folder, to, clientIdentity(r))
+	logger.AddAttrs(ctx, slog.Int("moved", moved))
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to move folder")
+		return
+	}
+	writeJSON(w, http.StatusOK, moveFolderResponse{Moved: moved})
+}
+
+func (h *FileHandler) deleteFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	folder := r.PathValue("path")
+	logger.AddAttrs(ctx, slog.String("folder", folder))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var recursive bool
+	if v := r.URL.Query().Get("recursive"); v != "" {
+		var err error
+		if recursive, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid recursive")
+			return
+		}
+	}
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	deleted, err := bucket.DeleteFolder(folder, recursive, h.policy.TrashRetention())
+	logger.AddAttrs(ctx, slog.Int("deleted", deleted))
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to delete folder")
+		return
+	}
+	writeJSON(w, http.StatusOK, deleteFolderResponse{Deleted: deleted})
+}
@@ -0,0 +1,457 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"tagesTest/internal/config"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+	"tagesTest/internal/service"
+	"tagesTest/internal/webhook"
+	"tagesTest/pkg/limiter"
+)
+
+type fileInfo struct {
+	Filename  string            `json:"filename"`
+	CreatedAt string            `json:"created_at"`
+	UpdatedAt string            `json:"updated_at"`
+	Size      int64             `json:"size"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+}
+
+func newFileInfo(file domain.File) fileInfo {
+	return fileInfo{
+		Filename:  file.Filename,
+		CreatedAt: file.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: file.UpdatedAt.Format(time.RFC3339),
+		Size:      file.Size,
+		Metadata:  file.Attributes.Metadata,
+		Tags:      file.Attributes.Tags,
+	}
+}
+
+type listFilesResponse struct {
+	Files          []fileInfo `json:"files"`
+	CommonPrefixes []string   `json:"common_prefixes,omitempty"`
+}
+
+// uploadFileResponse mirrors the gRPC UploadFileResponse.
+type uploadFileResponse struct {
+	Message  string `json:"message"`
+	Size     int64  `json:"size"`
+	Version  int64  `json:"version"`
+	Checksum string `json:"checksum"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type FileHandler struct {
+	buckets       *service.Buckets
+	policy        *policy.Policy
+	webhooks      *webhook.Dispatcher
+	uploadTimeout time.Duration
+}
+
+func NewFileHandler(
+	buckets *service.Buckets, pol *policy.Policy, webhooks *webhook.Dispatcher, cfg *config.Config,
+) *FileHandler {
+	return &FileHandler{
+		buckets:       buckets,
+		policy:        pol,
+		webhooks:      webhooks,
+		uploadTimeout: cfg.UploadTimeout,
+	}
+}
+
+func (h *FileHandler) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files", h.listFiles)
+	mux.HandleFunc("POST /files", h.uploadForm)
+	// file names may contain slashes, so the name takes the rest of the path
+	mux.HandleFunc("PUT /files/{name...}", h.uploadFile)
+	mux.HandleFunc("GET /files/{name...}", h.downloadFile)
+	mux.HandleFunc("POST /files/{name...}", h.renameFile)
+	mux.HandleFunc("PATCH /files/{name...}", h.updateMetadata)
+	// routes about a file put the name last for the same reason
+	mux.HandleFunc("GET /versions/{name...}", h.listVersions)
+	mux.HandleFunc("GET /search", h.searchFiles)
+	mux.HandleFunc("GET /archive", h.downloadArchive)
+	// deleting is a write, so it is charged against the upload budget
+	mux.HandleFunc("DELETE /files/{name...}", h.deleteFile)
+	mux.HandleFunc("GET /trash", h.listTrash)
+	mux.HandleFunc("POST /trash/{id}/restore", h.restoreFile)
+	mux.HandleFunc("DELETE /trash/{id}", h.purgeTrash)
+	mux.HandleFunc("POST /share-links/{name...}", h.createShareLink)
+	mux.HandleFunc("DELETE /share-links/{id}", h.revokeShareLink)
+	mux.HandleFunc("GET /shared/{token}", h.downloadShared)
+	mux.HandleFunc("GET /webhooks", h.webhookStatus)
+	mux.HandleFunc("GET /usage", h.usage)
+	mux.HandleFunc("GET /buckets", h.listBuckets)
+	mux.HandleFunc("PUT /buckets/{bucket}", h.createBucket)
+	mux.HandleFunc("DELETE /buckets/{bucket}", h.deleteBucket)
+	mux.HandleFunc("PUT /folders/{path...}", h.createFolder)
+	mux.HandleFunc("POST /folders/{path...}", h.moveFolder)
+	mux.HandleFunc("DELETE /folders/{path...}", h.deleteFolder)
+	return mux
+}
+
+func (h *FileHandler) uploadFile(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.uploadTimeout)
+	defer cancel()
+
+	filename := r.PathValue("name")
+	logger.AddAttrs(ctx, slog.String("filename", filename))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if !h.policy.IsImage(filename) {
+		writeError(w, http.StatusBadRequest, "not an image")
+		return
+	}
+	files, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	bucket := files.Bucket()
+	if !bucket.Allows(filename) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("file type not allowed in bucket %s", bucket.Name))
+		return
+	}
+	opts, err := writeOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Retention = h.policy.VersionRetention()
+	opts.Owner = clientIdentity(r)
+	opts.Quotas = h.policy.Quotas(bucket, opts.Owner)
+
+	body := h.policy.BucketReader(bucket, h.policy.UploadReader(ctx, opts.Owner, r.Body))
+	saved, err := files.WriteFile(filename, body, opts)
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to upload file")
+		return
+	}
+	logger.AddAttrs(ctx, slog.Int64("bytes", saved.Size), slog.Int64("version", saved.Version))
+	writeJSON(w, http.StatusCreated, uploadFileResponse{
+		Message:  fmt.Sprintf("File uploaded successfully. Size: %d bytes", saved.Size),
+		Size:     saved.Size,
+		Version:  saved.Version,
+		Checksum: saved.Checksum,
+	})
+}
+
+// writeModes are the values of the mode query parameter of uploads.
+var writeModes = map[string]domain.WriteMode{
+	"":                   domain.WriteCreateOnly,
+	"create_only":        domain.WriteCreateOnly,
+	"overwrite":          domain.WriteOverwrite,
+	"overwrite_if_match": domain.WriteOverwriteIfMatch,
+}
+
+// writeOptions reads the write mode of an upload, mirroring the fields of the
+// gRPC UploadFileRequest.
+func writeOptions(query url.Values) (domain.WriteOptions, error) {
+	var opts domain.WriteOptions
+	mode, ok := writeModes[query.Get("mode")]
+	if !ok {
+		return opts, fmt.Errorf("unknown write mode %q", query.Get("mode"))
+	}
+	opts.Mode = mode
+	if query.Has("new_version") {
+		keep, err := strconv.ParseBool(query.Get("new_version"))
+		if err != nil {
+			return opts, errors.New("invalid new_version")
+		}
+		opts.KeepVersion = keep
+		if keep && !query.Has("mode") {
+			opts.Mode = domain.WriteOverwrite
+		}
+	}
+	if v := query.Get("if_generation"); v != "" {
+		generation, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || generation <= 0 {
+			return opts, errors.New("invalid if_generation")
+		}
+		opts.IfGeneration = generation
+	}
+	opts.IfChecksum = query.Get("if_checksum")
+	opts.Metadata, opts.Tags = queryAttributes(query)
+	if v := query.Get("ttl_seconds"); v != "" {
+		ttl, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ttl < 0 {
+			return opts, errors.New("invalid ttl_seconds")
+		}
+		opts.TTL = time.Duration(ttl) * time.Second
+	}
+	if opts.Mode == domain.WriteOverwriteIfMatch && opts.IfGeneration == 0 && opts.IfChecksum == "" {
+		return opts, errors.New("if_generation or if_checksum is required")
+	}
+	return opts, nil
+}
+
+func (h *FileHandler) downloadFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filename := r.PathValue("name")
+	logger.AddAttrs(ctx, slog.String("filename", filename))
+
+	release, ok := h.acquire(ctx, w, r, policy.Download)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if !h.policy.IsImage(filename) {
+		writeError(w, http.StatusBadRequest, "not an image")
+		return
+	}
+	var version int64
+	if v := r.URL.Query().Get("version"); v != "" {
+		var err error
+		version, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || version < 0 {
+			writeError(w, http.StatusBadRequest, "invalid version")
+			return
+		}
+		logger.AddAttrs(ctx, slog.Int64("version", version))
+	}
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	file, err := bucket.DownloadFileVersion(filename, version)
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to open file")
+		return
+	}
+	defer file.Close()
+
+	if info, err := bucket.StatFile(filename); err == nil {
+		w.Header().Set("Last-Modified", info.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+
+	n, err := io.Copy(w, h.policy.DownloadReader(ctx, clientIdentity(r), file))
+	logger.AddAttrs(ctx, slog.Int64("bytes", n))
+	if err != nil {
+		// headers are already sent, all we can do is cut the response short
+		logger.AddAttrs(ctx, slog.String("error", err.Error()))
+	}
+}
+
+func (h *FileHandler) deleteFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filename := r.PathValue("name")
+	logger.AddAttrs(ctx, slog.String("filename", filename))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	entry, err := bucket.DeleteFile(filename, h.policy.TrashRetention())
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to delete file")
+		return
+	}
+	if entry.ID == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	logger.AddAttrs(ctx, slog.String("trash_id", entry.ID))
+	writeJSON(w, http.StatusOK, newTrashEntry(entry))
+}
+
+type fileVersion struct {
+	Version   int64  `json:"version"`
+	Size      int64  `json:"size"`
+	Checksum  string `json:"checksum"`
+	CreatedAt string `json:"created_at"`
+	Latest    bool   `json:"latest"`
+}
+
+type listVersionsResponse struct {
+	Versions []fileVersion `json:"versions"`
+}
+
+func (h *FileHandler) listVersions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filename := r.PathValue("name")
+	logger.AddAttrs(ctx, slog.String("filename", filename))
+
+	release, ok := h.acquire(ctx, w, r, policy.List)
+	if !ok {
+		return
+	}
+	defer release()
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	versions, err := bucket.ListFileVersions(filename)
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to list versions")
+		return
+	}
+
+	resp := listVersionsResponse{Versions: make([]fileVersion, 0, len(versions))}
+	for _, v := range versions {
+		resp.Versions = append(resp.Versions, fileVersion{
+			Version:   v.Version,
+			Size:      v.Size,
+			Checksum:  v.Checksum,
+			CreatedAt: v.CreatedAt.Format(time.RFC3339),
+			Latest:    v.Latest,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type webhookStatusResponse struct {
+	Endpoints []webhook.Status `json:"endpoints"`
+}
+
+func (h *FileHandler) webhookStatus(w http.ResponseWriter, r *http.Request) {
+	release, ok := h.acquire(r.Context(), w, r, policy.List)
+	if !ok {
+		return
+	}
+	defer release()
+	writeJSON(w, http.StatusOK, webhookStatusResponse{Endpoints: h.webhooks.Status()})
+}
+
+func (h *FileHandler) listFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	release, ok := h.acquire(ctx, w, r, policy.List)
+	if !ok {
+		return
+	}
+	defer release()
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	var filter domain.FileFilter
+	filter.Metadata, filter.Tags = queryAttributes(query)
+	files, prefixes, err := bucket.ListFolder(query.Get("prefix"), query.Get("delimiter"), filter)
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to list files")
+		return
+	}
+	logger.AddAttrs(ctx, slog.Int("files", len(files)), slog.Int("prefixes", len(prefixes)))
+
+	resp := listFilesResponse{Files: make([]fileInfo, 0, len(files)), CommonPrefixes: prefixes}
+	for _, file := range files {
+		resp.Files = append(resp.Files, newFileInfo(file))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// acquire charges the request against the client and server-wide budgets of
+// op and writes the error response if either is exhausted.
+func (h *FileHandler) acquire(
+	ctx context.Context, w http.ResponseWriter, r *http.Request, op policy.Operation,
+) (func(), bool) {
+	client := clientIdentity(r)
+	logger.AddAttrs(ctx, slog.String("client", client))
+
+	releaseClient, err := h.policy.AcquireClient(op, client)
+	if err != nil {
+		var limitErr *limiter.LimitError
+		if errors.As(err, &limitErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(limitErr.RetryAfterSeconds()))
+		}
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return nil, false
+	}
+
+	releaseGlobal, err := h.policy.Acquire(ctx, op)
+	if err != nil {
+		releaseClient()
+		writeError(w, http.StatusServiceUnavailable, "server limit reached")
+		return nil, false
+	}
+	return func() {
+		releaseGlobal()
+		releaseClient()
+	}, true
+}
+
+func writeServiceError(ctx context.Context, w http.ResponseWriter, err error, msg string) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		logger.AddAttrs(ctx, slog.String("error", err.Error()))
+	}
+	writeError(w, status, fmt.Sprintf("%s: %v", msg, err))
+}
+
+// errorStatus maps service and policy errors to HTTP status codes.
+func errorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound), errors.Is(err, domain.ErrVersionNotFound),
+		errors.Is(err, domain.ErrTrashEntryNotFound), errors.Is(err, domain.ErrShareLinkNotFound),
+		errors.Is(err, domain.ErrBucketNotFound), errors.Is(err, domain.ErrFolderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrFileExists), errors.Is(err, domain.ErrBucketExists),
+		errors.Is(err, domain.ErrBucketNotEmpty), errors.Is(err, domain.ErrFolderNotEmpty):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, domain.ErrInvalidFilename), errors.Is(err, domain.ErrInvalidBucketName),
+		errors.Is(err, domain.ErrInvalidMetadata), errors.Is(err, domain.ErrInvalidSearch),
+		errors.Is(err, policy.ErrEmptyFile),
+		errors.Is(err, policy.ErrLinkTTL):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrShareLinkInvalid), errors.Is(err, domain.ErrNotOwner):
+		return http.StatusForbidden
+	case errors.Is(err, domain.ErrShareLinkExpired), errors.Is(err, domain.ErrShareLinkRevoked),
+		errors.Is(err, domain.ErrShareLinkExhausted):
+		return http.StatusGone
+	case errors.Is(err, policy.ErrTooLarge), errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
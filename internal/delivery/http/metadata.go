@@ -0,0 +1,88 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+)
+
+// metadataPrefix marks query parameters that carry metadata entries, as in
+// ?meta.sku=123.
+const metadataPrefix = "meta."
+
+// queryAttributes reads the tag and meta.<key> query parameters used both
+// by uploads and by list filters. Absent ones are nil.
+func queryAttributes(query url.Values) (map[string]string, []string) {
+	var metadata map[string]string
+	for key, values := range query {
+		name, ok := strings.CutPrefix(key, metadataPrefix)
+		if !ok {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[name] = values[0]
+	}
+	return metadata, query["tag"]
+}
+
+// updateMetadataRequest mirrors the gRPC UpdateMetadataRequest.
+type updateMetadataRequest struct {
+	SetMetadata    map[string]string `json:"set_metadata"`
+	RemoveMetadata []string          `json:"remove_metadata"`
+	AddTags        []string          `json:"add_tags"`
+	RemoveTags     []string          `json:"remove_tags"`
+}
+
+type metadataResponse struct {
+	Metadata map[string]string `json:"metadata"`
+	Tags     []string          `json:"tags"`
+}
+
+func (h *FileHandler) updateMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filename := r.PathValue("name")
+	logger.AddAttrs(ctx, slog.String("filename", filename))
+
+	release, ok := h.acquire(ctx, w, r, policy.Metadata)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var req updateMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	attributes, err := bucket.UpdateMetadata(filename, domain.AttributesUpdate{
+		SetMetadata:    req.SetMetadata,
+		RemoveMetadata: req.RemoveMetadata,
+		AddTags:        req.AddTags,
+		RemoveTags:     req.RemoveTags,
+	})
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to update metadata")
+		return
+	}
+	resp := metadataResponse{Metadata: attributes.Metadata, Tags: attributes.Tags}
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]string{}
+	}
+	if resp.Tags == nil {
+		resp.Tags = []string{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"tagesTest/internal/logger"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// loggingMiddleware assigns a request ID, taken from the X-Request-Id header
+// when it is well-formed or generated otherwise, and logs a single summary line per request.
+func loggingMiddleware(base *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := logger.RequestID(r.Header.Get(requestIDHeader))
+		w.Header().Set(requestIDHeader, requestID)
+
+		l := base.With(
+			slog.String("request_id", requestID),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+		)
+		ctx := logger.WithLogger(r.Context(), l)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		attrs := append([]slog.Attr{
+			slog.Int("status", rec.status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int64("response_bytes", rec.bytes),
+		}, logger.Attrs(ctx)...)
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		}
+		l.LogAttrs(ctx, level, "http request finished", attrs...)
+	})
+}
+
+// clientIdentity returns the verified TLS client certificate subject if there
+// is one, otherwise the remote IP address, matching the gRPC server.
+func clientIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return "cn:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
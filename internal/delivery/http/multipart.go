@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+	"tagesTest/internal/service"
+)
+
+// uploadResult is the outcome for a single file of a form upload. On success
+// it carries the same fields as UploadFileResponse.
+type uploadResult struct {
+	Filename string `json:"filename"`
+	Status   int    `json:"status"`
+	Message  string `json:"message,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type uploadFormResponse struct {
+	Results []uploadResult `json:"results"`
+}
+
+// uploadForm accepts multipart/form-data with any number of file parts. Each
+// part is streamed into storage as it arrives, so files are never buffered
+// in memory as a whole. Non-file form fields are ignored.
+func (h *FileHandler) uploadForm(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.uploadTimeout)
+	defer cancel()
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("expected multipart/form-data: %v", err))
+		return
+	}
+
+	files, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	client := clientIdentity(r)
+	resp := uploadFormResponse{Results: []uploadResult{}}
+	var uploaded int64
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("malformed multipart body: %v", err))
+			return
+		}
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		result := h.savePart(ctx, files, client, part.FileName(), part)
+		part.Close()
+		uploaded += result.Size
+		resp.Results = append(resp.Results, result)
+	}
+
+	if len(resp.Results) == 0 {
+		writeError(w, http.StatusBadRequest, "no files in form")
+		return
+	}
+	logger.AddAttrs(ctx, slog.Int("files", len(resp.Results)), slog.Int64("bytes", uploaded))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *FileHandler) savePart(
+	ctx context.Context, files *service.FileService, client, name string, body io.Reader,
+) uploadResult {
+	filename := filepath.Base(name)
+	result := uploadResult{Filename: filename}
+
+	if !h.policy.IsImage(filename) {
+		result.Status = http.StatusBadRequest
+		result.Error = "not an image"
+		return result
+	}
+	bucket := files.Bucket()
+	if !bucket.Allows(filename) {
+		result.Status = http.StatusBadRequest
+		result.Error = fmt.Sprintf("file type not allowed in bucket %s", bucket.Name)
+		return result
+	}
+	body = h.policy.BucketReader(bucket, h.policy.UploadReader(ctx, client, body))
+	// existing files are rejected by the create-only write itself
+	saved, err := files.WriteFile(filename, body, domain.WriteOptions{
+		Mode:   domain.WriteCreateOnly,
+		Owner:  client,
+		Quotas: h.policy.Quotas(bucket, client),
+	})
+	if err != nil {
+		result.Status = errorStatus(err)
+		result.Error = fmt.Sprintf("failed to upload file: %v", err)
+		return result
+	}
+
+	result.Status = http.StatusCreated
+	result.Message = fmt.Sprintf("File uploaded successfully. Size: %d bytes", saved.Size)
+	result.Size = saved.Size
+	result.Version = saved.Version
+	result.Checksum = saved.Checksum
+	return result
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/logger"
+)
+
+// renameFileResponse mirrors the gRPC RenameFileResponse and CopyFileResponse.
+type renameFileResponse struct {
+	Filename string `json:"filename"`
+	Version  int64  `json:"version"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// renameFile moves the file to the name given by the to query parameter, or
+// copies it there with copy=true. mode, if_generation and if_checksum apply
+// to an existing file at to, as in uploads.
+func (h *FileHandler) renameFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filename := r.PathValue("name")
+	query := r.URL.Query()
+	to := query.Get("to")
+	logger.AddAttrs(ctx, slog.String("filename", filename), slog.String("to", to))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var copying bool
+	if v := query.Get("copy"); v != "" {
+		var err error
+		if copying, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid copy")
+			return
+		}
+	}
+	if to == "" {
+		writeError(w, http.StatusBadRequest, "to is required")
+		return
+	}
+	if !h.policy.IsImage(to) {
+		writeError(w, http.StatusBadRequest, "not an image")
+		return
+	}
+	files, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	bucket := files.Bucket()
+	if !bucket.Allows(to) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("file type not allowed in bucket %s", bucket.Name))
+		return
+	}
+	opts, err := writeOptions(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// only the owner of a file may move or copy it
+	opts.Owner = clientIdentity(r)
+
+	if !copying {
+		renamed, err := files.RenameFile(filename, to, opts)
+		if err != nil {
+			writeServiceError(ctx, w, err, "failed to rename file")
+			return
+		}
+		writeJSON(w, http.StatusOK, renameFileResponse{
+			Filename: to,
+			Version:  renamed.Version,
+			Size:     renamed.Size,
+			Checksum: renamed.Checksum,
+		})
+		return
+	}
+
+	opts.Quotas = h.policy.Quotas(bucket, opts.Owner)
+	copied, err := files.CopyFile(filename, to, opts)
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to copy file")
+		return
+	}
+	logger.AddAttrs(ctx, slog.Int64("bytes", copied.Size))
+	writeJSON(w, http.StatusCreated, renameFileResponse{
+		Filename: to,
+		Version:  copied.Version,
+		Size:     copied.Size,
+		Checksum: copied.Checksum,
+	})
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+)
+
+type searchResult struct {
+	fileInfo
+	Width  int     `json:"width,omitempty"`
+	Height int     `json:"height,omitempty"`
+	Score  float64 `json:"score"`
+}
+
+// searchFilesResponse mirrors the gRPC SearchFilesResponse.
+type searchFilesResponse struct {
+	Results       []searchResult `json:"results"`
+	NextPageToken string         `json:"next_page_token,omitempty"`
+	Total         int            `json:"total"`
+}
+
+// searchFiles takes the fields of the gRPC SearchFilesRequest as query
+// parameters, with tag and meta.<key> as in listings.
+func (h *FileHandler) searchFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	logger.AddAttrs(ctx, slog.String("query", query.Get("name")))
+
+	release, ok := h.acquire(ctx, w, r, policy.List)
+	if !ok {
+		return
+	}
+	defer release()
+
+	q, err := searchQuery(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var pageSize int
+	if v := query.Get("page_size"); v != "" {
+		if pageSize, err = strconv.Atoi(v); err != nil || pageSize < 0 {
+			writeError(w, http.StatusBadRequest, "invalid page_size")
+			return
+		}
+	}
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	results, next, total, err := bucket.SearchFiles(q, query.Get("page_token"), pageSize)
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to search files")
+		return
+	}
+	logger.AddAttrs(ctx, slog.Int("files", len(results)), slog.Int("total", total))
+
+	resp := searchFilesResponse{Results: make([]searchResult, 0, len(results)), NextPageToken: next, Total: total}
+	for _, result := range results {
+		resp.Results = append(resp.Results, searchResult{
+			fileInfo: newFileInfo(result.File),
+			Width:    result.Version.Width,
+			Height:   result.Version.Height,
+			Score:    result.Score,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func searchQuery(query url.Values) (domain.SearchQuery, error) {
+	q := domain.SearchQuery{Name: query.Get("name"), Prefix: query.Get("prefix")}
+	q.Metadata, q.Tags = queryAttributes(query)
+	if v := query.Get("fuzzy"); v != "" {
+		fuzzy, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, errors.New("invalid fuzzy")
+		}
+		q.Fuzzy = fuzzy
+	}
+
+	var minWidth, maxWidth, minHeight, maxHeight int64
+	for key, dst := range map[string]*int64{
+		"min_size":   &q.MinSize,
+		"max_size":   &q.MaxSize,
+		"min_width":  &minWidth,
+		"max_width":  &maxWidth,
+		"min_height": &minHeight,
+		"max_height": &maxHeight,
+	} {
+		v := query.Get(key)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid %s", key)
+		}
+		*dst = n
+	}
+	q.MinWidth, q.MaxWidth = int(minWidth), int(maxWidth)
+	q.MinHeight, q.MaxHeight = int(minHeight), int(maxHeight)
+
+	for key, dst := range map[string]*time.Time{
+		"created_after":  &q.CreatedAfter,
+		"created_before": &q.CreatedBefore,
+		"updated_after":  &q.UpdatedAfter,
+		"updated_before": &q.UpdatedBefore,
+	} {
+		v := query.Get(key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid %s: %v", key, err)
+		}
+		*dst = t
+	}
+	return q, nil
+}
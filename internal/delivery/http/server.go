@@ -0,0 +1,82 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"tagesTest/internal/config"
+	"tagesTest/internal/delivery/certs"
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/service"
+	"tagesTest/internal/webhook"
+)
+
+var ErrForcedShutdown = errors.New("drain timeout exceeded, remaining requests were cancelled")
+
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+	inFlight sync.WaitGroup
+}
+
+// NewServer creates the HTTP gateway. reloader may be nil when TLS is disabled.
+func NewServer(
+	cfg *config.Config, buckets *service.Buckets, pol *policy.Policy, webhooks *webhook.Dispatcher,
+	reloader *certs.Reloader, logger *slog.Logger,
+) (*Server, error) {
+	listener, err := net.Listen("tcp", cfg.HTTPAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{listener: listener}
+	handler := NewFileHandler(buckets, pol, webhooks, cfg)
+	s.server = &http.Server{
+		Handler:           s.track(loggingMiddleware(logger, handler.Routes())),
+		ReadHeaderTimeout: cfg.HeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+	if reloader != nil {
+		s.server.TLSConfig = reloader.ServerConfig()
+	}
+	return s, nil
+}
+
+func (s *Server) Start() error {
+	var err error
+	if s.server.TLSConfig != nil {
+		err = s.server.ServeTLS(s.listener, "", "")
+	} else {
+		err = s.server.Serve(s.listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop waits for in-flight requests to finish. Requests still running when
+// ctx is done are cancelled, which rolls back their partial uploads, and
+// ErrForcedShutdown is returned.
+func (s *Server) Stop(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	if err == nil {
+		return nil
+	}
+	s.server.Close()
+	s.inFlight.Wait()
+	return ErrForcedShutdown
+}
+
+// track counts running handlers so Stop can wait for cancelled ones to clean up.
+func (s *Server) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Done()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/logger"
+)
+
+type createShareLinkRequest struct {
+	TTLSeconds   int64 `json:"ttl_seconds"`
+	MaxDownloads int   `json:"max_downloads"`
+}
+
+// createShareLinkResponse mirrors the gRPC CreateShareLinkResponse.
+type createShareLinkResponse struct {
+	ID        string `json:"id"`
+	Token     string `json:"token"`
+	URL       string `json:"url,omitempty"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+func (h *FileHandler) createShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filename := r.PathValue("name")
+	logger.AddAttrs(ctx, slog.String("filename", filename))
+
+	release, ok := h.acquire(ctx, w, r, policy.Metadata)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// the body is optional, an empty one asks for the defaults
+	var req createShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if req.MaxDownloads < 0 {
+		writeError(w, http.StatusBadRequest, "max_downloads must not be negative")
+		return
+	}
+	expiresAt, err := h.policy.ShareLinkExpiry(time.Now(), time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to create share link")
+		return
+	}
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	link, token, err := bucket.CreateShareLink(filename, expiresAt, req.MaxDownloads)
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to create share link")
+		return
+	}
+	logger.AddAttrs(ctx, slog.String("share_link", link.ID))
+	writeJSON(w, http.StatusCreated, createShareLinkResponse{
+		ID:        link.ID,
+		Token:     token,
+		URL:       h.policy.ShareLinkURL(token),
+		ExpiresAt: link.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+func (h *FileHandler) revokeShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	logger.AddAttrs(ctx, slog.String("share_link", id))
+
+	release, ok := h.acquire(ctx, w, r, policy.Metadata)
+	if !ok {
+		return
+	}
+	defer release()
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	if err := bucket.RevokeShareLink(id); err != nil {
+		writeServiceError(ctx, w, err, "failed to revoke share link")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// downloadShared serves a file through a share link. The link is the only
+// credential, so it works for clients without access to the rest of the API.
+func (h *FileHandler) downloadShared(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	release, ok := h.acquire(ctx, w, r, policy.Download)
+	if !ok {
+		return
+	}
+	defer release()
+
+	link, file, err := h.buckets.OpenShareLink(r.PathValue("token"))
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to open share link")
+		return
+	}
+	defer file.Close()
+	logger.AddAttrs(ctx, slog.String("filename", link.Filename), slog.String("share_link", link.ID))
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", link.Filename))
+	w.WriteHeader(http.StatusOK)
+
+	n, err := io.Copy(w, h.policy.DownloadReader(ctx, clientIdentity(r), file))
+	logger.AddAttrs(ctx, slog.Int64("bytes", n))
+	if err != nil {
+		logger.AddAttrs(ctx, slog.String("error", err.Error()))
+	}
+}
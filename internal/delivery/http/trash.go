@@ -0,0 +1,101 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+)
+
+type trashEntry struct {
+	ID        string `json:"id"`
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size"`
+	DeletedAt string `json:"deleted_at"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+func newTrashEntry(entry domain.TrashEntry) trashEntry {
+	return trashEntry{
+		ID:        entry.ID,
+		Filename:  entry.Filename,
+		Size:      entry.Size,
+		DeletedAt: entry.DeletedAt.Format(time.RFC3339),
+		ExpiresAt: entry.ExpiresAt.Format(time.RFC3339),
+	}
+}
+
+type listTrashResponse struct {
+	Entries []trashEntry `json:"entries"`
+}
+
+func (h *FileHandler) listTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	release, ok := h.acquire(ctx, w, r, policy.List)
+	if !ok {
+		return
+	}
+	defer release()
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	entries := bucket.ListTrash()
+	logger.AddAttrs(ctx, slog.Int("entries", len(entries)))
+
+	resp := listTrashResponse{Entries: make([]trashEntry, 0, len(entries))}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, newTrashEntry(entry))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *FileHandler) restoreFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	logger.AddAttrs(ctx, slog.String("trash_id", id))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	entry, err := bucket.RestoreFile(id)
+	if err != nil {
+		writeServiceError(ctx, w, err, "failed to restore file")
+		return
+	}
+	logger.AddAttrs(ctx, slog.String("filename", entry.Filename))
+	writeJSON(w, http.StatusOK, newTrashEntry(entry))
+}
+
+func (h *FileHandler) purgeTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	logger.AddAttrs(ctx, slog.String("trash_id", id))
+
+	release, ok := h.acquire(ctx, w, r, policy.Upload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	if _, err := bucket.PurgeTrash([]string{id}); err != nil {
+		writeServiceError(ctx, w, err, "failed to purge trash entry")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
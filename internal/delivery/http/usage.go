@@ -0,0 +1,57 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+
+	"tagesTest/internal/delivery/policy"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/logger"
+)
+
+// usage mirrors the gRPC Usage message.
+type usage struct {
+	Bytes    int64 `json:"bytes"`
+	Files    int64 `json:"files"`
+	MaxBytes int64 `json:"max_bytes"`
+	MaxFiles int64 `json:"max_files"`
+}
+
+type usageResponse struct {
+	Owner  string `json:"owner"`
+	Usage  usage  `json:"usage"`
+	Global usage  `json:"global"`
+	Bucket usage  `json:"bucket"`
+}
+
+func newUsage(u domain.Usage, quota domain.Quota) usage {
+	return usage{Bytes: u.Bytes, Files: u.Files, MaxBytes: quota.MaxBytes, MaxFiles: quota.MaxFiles}
+}
+
+func (h *FileHandler) usage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	release, ok := h.acquire(ctx, w, r, policy.List)
+	if !ok {
+		return
+	}
+	defer release()
+
+	owner := r.URL.Query().Get("owner")
+	if owner == "" {
+		owner = clientIdentity(r)
+	}
+	logger.AddAttrs(ctx, slog.String("owner", owner))
+
+	bucket, ok := h.bucket(w, r)
+	if !ok {
+		return
+	}
+	current, total := bucket.Usage(owner)
+	quotas := h.policy.Quotas(bucket.Bucket(), owner)
+	writeJSON(w, http.StatusOK, usageResponse{
+		Owner:  owner,
+		Usage:  newUsage(current, quotas.Owner),
+		Global: newUsage(total, quotas.Global),
+		Bucket: newUsage(bucket.BucketUsage(), quotas.Bucket),
+	})
+}
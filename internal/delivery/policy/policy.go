@@ -0,0 +1,298 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"tagesTest/internal/archive"
+	"tagesTest/internal/config"
+	"tagesTest/internal/domain"
+	"tagesTest/pkg/limiter"
+)
+
+// Operation groups requests that share the same limits.
+type Operation int
+
+const (
+	Upload Operation = iota
+	Download
+	List
+	// Metadata changes share links, metadata and tags without touching
+	// file contents.
+	Metadata
+	// Watch has per-client limits only, events.max_watchers caps the
+	// streams of all clients together.
+	Watch
+)
+
+var (
+	ErrTooLarge  = errors.New("file exceeds max size")
+	ErrEmptyFile = errors.New("no file data received")
+	ErrLinkTTL   = errors.New("invalid share link lifetime")
+)
+
+// Policy holds the limits and image rules shared by all transports, so a
+// client gets the same budget whether it talks gRPC or HTTP.
+type Policy struct {
+	global            map[Operation]*limiter.Limiter
+	clients           map[Operation]*limiter.KeyedLimiter
+	uploadBandwidth   *limiter.Bandwidth
+	downloadBandwidth *limiter.Bandwidth
+	imagePolicy       atomic.Pointer[config.ImagePolicy]
+	shareLinks        atomic.Pointer[config.ShareLinks]
+	archiveLimits     atomic.Pointer[config.ArchiveLimits]
+	versioning        atomic.Pointer[config.Versioning]
+	trashRetention    atomic.Int64
+	lifecycleRules    atomic.Pointer[[]domain.LifecycleRule]
+	quotas            atomic.Pointer[config.Quotas]
+}
+
+func New(cfg *config.Config) *Policy {
+	p := &Policy{
+		global: map[Operation]*limiter.Limiter{
+			Upload:   limiter.NewLimiter(cfg.Limits.Upload),
+			Download: limiter.NewLimiter(cfg.Limits.Download),
+			List:     limiter.NewLimiter(cfg.Limits.List),
+			Metadata: limiter.NewLimiter(cfg.Limits.Metadata),
+		},
+		clients: map[Operation]*limiter.KeyedLimiter{
+			Upload:   limiter.NewKeyedLimiter(toClientLimit(cfg.ClientLimits.Upload)),
+			Download: limiter.NewKeyedLimiter(toClientLimit(cfg.ClientLimits.Download)),
+			List:     limiter.NewKeyedLimiter(toClientLimit(cfg.ClientLimits.List)),
+			Metadata: limiter.NewKeyedLimiter(toClientLimit(cfg.ClientLimits.Metadata)),
+			Watch:    limiter.NewKeyedLimiter(toClientLimit(cfg.ClientLimits.Watch)),
+		},
+		uploadBandwidth:   limiter.NewBandwidth(cfg.Bandwidth.Upload.Global, cfg.Bandwidth.Upload.PerClient),
+		downloadBandwidth: limiter.NewBandwidth(cfg.Bandwidth.Download.Global, cfg.Bandwidth.Download.PerClient),
+	}
+	policy := cfg.ImagePolicy
+	p.imagePolicy.Store(&policy)
+	shareLinks := cfg.ShareLinks
+	p.shareLinks.Store(&shareLinks)
+	archiveLimits := cfg.Archive
+	p.archiveLimits.Store(&archiveLimits)
+	versioning := cfg.Versioning
+	p.versioning.Store(&versioning)
+	p.trashRetention.Store(int64(cfg.Trash.Retention))
+	rules := make([]domain.LifecycleRule, 0, len(cfg.Lifecycle.Rules))
+	for _, rule := range cfg.Lifecycle.Rules {
+		rules = append(rules, domain.LifecycleRule(rule))
+	}
+	p.lifecycleRules.Store(&rules)
+	quotas := cfg.Quotas
+	p.quotas.Store(&quotas)
+	return p
+}
+
+// Reload applies new limits, bandwidth budgets and image rules. Calls that
+// are already running keep their slots.
+func (p *Policy) Reload(cfg *config.Config) {
+	p.global[Upload].SetLimit(cfg.Limits.Upload)
+	p.global[Download].SetLimit(cfg.Limits.Download)
+	p.global[List].SetLimit(cfg.Limits.List)
+	p.global[Metadata].SetLimit(cfg.Limits.Metadata)
+
+	p.clients[Upload].SetLimit(toClientLimit(cfg.ClientLimits.Upload))
+	p.clients[Download].SetLimit(toClientLimit(cfg.ClientLimits.Download))
+	p.clients[List].SetLimit(toClientLimit(cfg.ClientLimits.List))
+	p.clients[Metadata].SetLimit(toClientLimit(cfg.ClientLimits.Metadata))
+	p.clients[Watch].SetLimit(toClientLimit(cfg.ClientLimits.Watch))
+
+	p.uploadBandwidth.SetRates(cfg.Bandwidth.Upload.Global, cfg.Bandwidth.Upload.PerClient)
+	p.downloadBandwidth.SetRates(cfg.Bandwidth.Download.Global, cfg.Bandwidth.Download.PerClient)
+
+	policy := cfg.ImagePolicy
+	p.imagePolicy.Store(&policy)
+	shareLinks := cfg.ShareLinks
+	p.shareLinks.Store(&shareLinks)
+	archiveLimits := cfg.Archive
+	p.archiveLimits.Store(&archiveLimits)
+	versioning := cfg.Versioning
+	p.versioning.Store(&versioning)
+	p.trashRetention.Store(int64(cfg.Trash.Retention))
+	rules := make([]domain.LifecycleRule, 0, len(cfg.Lifecycle.Rules))
+	for _, rule := range cfg.Lifecycle.Rules {
+		rules = append(rules, domain.LifecycleRule(rule))
+	}
+	p.lifecycleRules.Store(&rules)
+	quotas := cfg.Quotas
+	p.quotas.Store(&quotas)
+}
+
+// Acquire waits for a server-wide slot for op.
+func (p *Policy) Acquire(ctx context.Context, op Operation) (func(), error) {
+	l := p.global[op]
+	if err := l.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	return func() { l.Release() }, nil
+}
+
+// AcquireClient charges a request of client against its own budget for op.
+// It fails with *limiter.LimitError when the budget is exhausted.
+func (p *Policy) AcquireClient(op Operation, client string) (func(), error) {
+	return p.clients[op].Acquire(client)
+}
+
+func (p *Policy) IsImage(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, allowed := range p.imagePolicy.Load().AllowedExtensions {
+		if ext == strings.ToLower(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShareLinkExpiry returns the expiry of a share link created at now with the
+// requested ttl. Zero ttl picks the configured default.
+func (p *Policy) ShareLinkExpiry(now time.Time, ttl time.Duration) (time.Time, error) {
+	rules := p.shareLinks.Load()
+	if ttl == 0 {
+		ttl = rules.DefaultTTL
+	}
+	if ttl < 0 || ttl > rules.MaxTTL {
+		return time.Time{}, fmt.Errorf("%w: must be between 1s and %s", ErrLinkTTL, rules.MaxTTL)
+	}
+	return now.Add(ttl), nil
+}
+
+// ShareLinkURL returns the HTTP gateway address for token, or an empty string
+// if no public base URL is configured.
+func (p *Policy) ShareLinkURL(token string) string {
+	base := p.shareLinks.Load().BaseURL
+	if base == "" {
+		return ""
+	}
+	return strings.TrimSuffix(base, "/") + "/shared/" + token
+}
+
+// UploadReader throttles r to the upload bandwidth of client. It fails with
+// ErrTooLarge once more than the allowed image size has been read and with
+// ErrEmptyFile if r has no data at all.
+func (p *Policy) UploadReader(ctx context.Context, client string, r io.Reader) io.Reader {
+	return &policyReader{
+		ctx:       ctx,
+		r:         r,
+		client:    client,
+		bandwidth: p.uploadBandwidth,
+		maxSize:   p.imagePolicy.Load().MaxSize,
+		nonEmpty:  true,
+	}
+}
+
+// ArchiveReader throttles an uploaded archive like UploadReader, but limits
+// it to the archive size instead of the image size.
+func (p *Policy) ArchiveReader(ctx context.Context, client string, r io.Reader) io.Reader {
+	return &policyReader{
+		ctx:       ctx,
+		r:         r,
+		client:    client,
+		bandwidth: p.uploadBandwidth,
+		maxSize:   p.archiveLimits.Load().MaxSize,
+		nonEmpty:  true,
+	}
+}
+
+// ArchiveLimits returns the limits for extracting an uploaded archive.
+func (p *Policy) ArchiveLimits() archive.Limits {
+	limits := p.archiveLimits.Load()
+	return archive.Limits{MaxEntries: limits.MaxEntries, MaxTotalSize: limits.MaxTotalSize}
+}
+
+// VersionRetention returns how many older file versions to keep and for how long.
+func (p *Policy) VersionRetention() domain.VersionRetention {
+	versioning := p.versioning.Load()
+	return domain.VersionRetention{KeepLast: versioning.MaxVersions, MaxAge: versioning.MaxAge}
+}
+
+// TrashRetention returns how long deleted files stay in the trash.
+func (p *Policy) TrashRetention() time.Duration {
+	return time.Duration(p.trashRetention.Load())
+}
+
+// LifecycleRules returns the rules the lifecycle scheduler applies.
+func (p *Policy) LifecycleRules() []domain.LifecycleRule {
+	return *p.lifecycleRules.Load()
+}
+
+// Quotas returns the limits for files of owner in bucket. The quota of the
+// bucket narrows the global one field by field.
+func (p *Policy) Quotas(bucket domain.Bucket, owner string) domain.Quotas {
+	quotas := p.quotas.Load()
+	quota, ok := quotas.Owners[owner]
+	if !ok {
+		quota = quotas.Default
+	}
+	global := domain.Quota(quotas.Global)
+	return domain.Quotas{Owner: domain.Quota(quota), Global: global, Bucket: global.Narrow(bucket.Quota)}
+}
+
+// BucketReader limits r to the file size of bucket on top of the limits
+// UploadReader already applies.
+func (p *Policy) BucketReader(bucket domain.Bucket, r io.Reader) io.Reader {
+	if bucket.MaxFileSize <= 0 {
+		return r
+	}
+	return &policyReader{r: r, maxSize: bucket.MaxFileSize}
+}
+
+// EntryReader applies the image size rules of UploadReader to a file
+// extracted from an archive. The archive itself is already throttled.
+func (p *Policy) EntryReader(r io.Reader) io.Reader {
+	return &policyReader{
+		r:        r,
+		maxSize:  p.imagePolicy.Load().MaxSize,
+		nonEmpty: true,
+	}
+}
+
+// DownloadReader throttles r to the download bandwidth of client.
+func (p *Policy) DownloadReader(ctx context.Context, client string, r io.Reader) io.Reader {
+	return &policyReader{
+		ctx:       ctx,
+		r:         r,
+		client:    client,
+		bandwidth: p.downloadBandwidth,
+	}
+}
+
+type policyReader struct {
+	ctx       context.Context
+	r         io.Reader
+	client    string
+	bandwidth *limiter.Bandwidth
+	maxSize   int64
+	nonEmpty  bool
+	read      int64
+}
+
+func (r *policyReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	if n <= 0 {
+		if err == io.EOF && r.nonEmpty && r.read == 0 {
+			return 0, ErrEmptyFile
+		}
+		return n, err
+	}
+	r.read += int64(n)
+	if r.maxSize > 0 && r.read > r.maxSize {
+		return 0, fmt.Errorf("%w of %d bytes", ErrTooLarge, r.maxSize)
+	}
+	if r.bandwidth != nil {
+		if waitErr := r.bandwidth.WaitN(r.ctx, r.client, n); waitErr != nil {
+			return 0, waitErr
+		}
+	}
+	return n, err
+}
+
+func toClientLimit(l config.RPCLimit) limiter.ClientLimit {
+	return limiter.ClientLimit{Rate: l.Rate, Burst: l.Burst, MaxConcurrent: l.MaxConcurrent}
+}
@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"maps"
+	"slices"
+)
+
+// Limits of the attributes of one file.
+const (
+	MaxMetadataEntries = 32
+	MaxTags            = 32
+	maxKeyLength       = 128
+	maxValueLength     = 1024
+)
+
+// Attributes are what users attach to a file: key/value metadata and tags.
+// Tags are kept sorted.
+type Attributes struct {
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+}
+
+// Validate fails with ErrInvalidMetadata if a key, value or tag is empty or
+// too long, or if there are too many of them.
+func (a Attributes) Validate() error {
+	if len(a.Metadata) > MaxMetadataEntries || len(a.Tags) > MaxTags {
+		return ErrInvalidMetadata
+	}
+	for key, value := range a.Metadata {
+		if key == "" || len(key) > maxKeyLength || len(value) > maxValueLength {
+			return ErrInvalidMetadata
+		}
+	}
+	for _, tag := range a.Tags {
+		if tag == "" || len(tag) > maxKeyLength {
+			return ErrInvalidMetadata
+		}
+	}
+	return nil
+}
+
+// Clone returns a copy sharing nothing with a.
+func (a Attributes) Clone() Attributes {
+	return Attributes{Metadata: maps.Clone(a.Metadata), Tags: slices.Clone(a.Tags)}
+}
+
+// SortTags returns tags sorted and without duplicates.
+func SortTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	return slices.Compact(slices.Sorted(slices.Values(tags)))
+}
+
+// AttributesUpdate changes some of the attributes of a file, leaving the
+// rest as they are. Removals are applied before additions.
+type AttributesUpdate struct {
+	SetMetadata    map[string]string
+	RemoveMetadata []string
+	AddTags        []string
+	RemoveTags     []string
+}
+
+// Apply returns a with the update applied.
+func (u AttributesUpdate) Apply(a Attributes) Attributes {
+	a = a.Clone()
+	for _, key := range u.RemoveMetadata {
+		delete(a.Metadata, key)
+	}
+	if len(u.SetMetadata) > 0 && a.Metadata == nil {
+		a.Metadata = make(map[string]string, len(u.SetMetadata))
+	}
+	maps.Copy(a.Metadata, u.SetMetadata)
+	a.Tags = slices.DeleteFunc(a.Tags, func(tag string) bool {
+		return slices.Contains(u.RemoveTags, tag)
+	})
+	a.Tags = SortTags(append(a.Tags, u.AddTags...))
+	if len(a.Metadata) == 0 {
+		a.Metadata = nil
+	}
+	if len(a.Tags) == 0 {
+		a.Tags = nil
+	}
+	return a
+}
+
+// FileFilter selects files by their attributes. A file matches if it has
+// every one of Tags and every entry of Metadata; the zero filter matches
+// every file.
+type FileFilter struct {
+	Tags     []string
+	Metadata map[string]string
+}
+
+func (f FileFilter) IsZero() bool {
+	return len(f.Tags) == 0 && len(f.Metadata) == 0
+}
+
+func (f FileFilter) Matches(a Attributes) bool {
+	for _, tag := range f.Tags {
+		if _, ok := slices.BinarySearch(a.Tags, tag); !ok {
+			return false
+		}
+	}
+	for key, value := range f.Metadata {
+		if got, ok := a.Metadata[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Bucket is a namespace of its own for files. Its limits narrow the server
+// wide ones, zero values leave them as they are. The default bucket has no
+// name and no limits.
+type Bucket struct {
+	Name              string    `json:"name"`
+	CreatedAt         time.Time `json:"created_at"`
+	AllowedExtensions []string  `json:"allowed_extensions,omitempty"`
+	MaxFileSize       int64     `json:"max_file_size,omitempty"`
+	// Quota limits the bucket as a whole.
+	Quota Quota `json:"quota"`
+}
+
+// Allows reports whether filename has one of the bucket's extensions.
+func (b Bucket) Allows(filename string) bool {
+	if len(b.AllowedExtensions) == 0 {
+		return true
+	}
+	ext := filepath.Ext(filename)
+	for _, allowed := range b.AllowedExtensions {
+		if strings.EqualFold(ext, allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package domain
+
+import "errors"
+
+var (
+	ErrFileNotFound    = errors.New("file not found")
+	ErrFileExists      = errors.New("file already exists")
+	ErrInvalidFilename = errors.New("invalid filename")
+	ErrVersionNotFound = errors.New("file version not found")
+	// ErrPreconditionFailed means a conditional write found the file changed.
+	ErrPreconditionFailed = errors.New("file does not match the expected version")
+	ErrFolderNotFound     = errors.New("folder not found")
+	ErrFolderNotEmpty     = errors.New("folder is not empty")
+	ErrQuotaExceeded      = errors.New("storage quota exceeded")
+	ErrInvalidMetadata    = errors.New("invalid metadata or tags")
+	ErrInvalidSearch      = errors.New("invalid search query")
+	// ErrNotOwner means the file belongs to another client.
+	ErrNotOwner = errors.New("file belongs to another owner")
+
+	ErrTrashEntryNotFound = errors.New("trash entry not found")
+
+	ErrBucketNotFound    = errors.New("bucket not found")
+	ErrBucketExists      = errors.New("bucket already exists")
+	ErrBucketNotEmpty    = errors.New("bucket is not empty")
+	ErrInvalidBucketName = errors.New("invalid bucket name")
+
+	ErrShareLinkNotFound  = errors.New("share link not found")
+	ErrShareLinkInvalid   = errors.New("invalid share link")
+	ErrShareLinkExpired   = errors.New("share link expired")
+	ErrShareLinkRevoked   = errors.New("share link revoked")
+	ErrShareLinkExhausted = errors.New("share link download limit reached")
+)
@@ -5,7 +5,113 @@ import "time"
 type File struct {
 	Filename  string
 	Filetype  string
+	Size      int64
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Path      string
+	// Cold is set for files served from the cold storage tier.
+	Cold bool
+	// Bucket is set in events of files outside the default bucket.
+	Bucket string
+	// Attributes are filled in by listings.
+	Attributes Attributes
+}
+
+// FileVersion is one generation of a file's content. Versions of a file are
+// numbered from 1 in upload order.
+type FileVersion struct {
+	Version   int64     `json:"version"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Latest    bool      `json:"-"`
+	// Width and Height are zero for content that is not a known image
+	// format.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// VersionRetention limits the older versions kept per file. Zero values
+// mean no limit.
+type VersionRetention struct {
+	KeepLast int
+	MaxAge   time.Duration
+}
+
+// WriteMode decides what a write does when the file already exists.
+type WriteMode int
+
+const (
+	// WriteCreateOnly fails with ErrFileExists.
+	WriteCreateOnly WriteMode = iota
+	// WriteOverwrite replaces the file.
+	WriteOverwrite
+	// WriteOverwriteIfMatch replaces the file only if its current version
+	// matches IfGeneration and IfChecksum, and fails with
+	// ErrPreconditionFailed otherwise, including when the file is missing.
+	WriteOverwriteIfMatch
+)
+
+// WriteOptions control how a file is written. Zero IfGeneration and empty
+// IfChecksum are not compared. With KeepVersion the replaced content stays
+// available as an older version, pruned according to Retention.
+type WriteOptions struct {
+	Mode         WriteMode
+	IfGeneration int64
+	IfChecksum   string
+	KeepVersion  bool
+	Retention    VersionRetention
+	// TTL makes the file expire that long after the write, zero keeps it
+	// until deleted.
+	TTL time.Duration
+	// Owner is charged for a new file. Writes to an existing file are
+	// charged to its owner.
+	Owner  string
+	Quotas Quotas
+	// Metadata and Tags replace those of the file, nil keeps them.
+	Metadata map[string]string
+	Tags     []string
+}
+
+// Quota limits what an owner or the whole storage may hold. Zero means no
+// limit.
+type Quota struct {
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	MaxFiles int64 `json:"max_files,omitempty"`
+}
+
+// Narrow returns the stricter of q and other in each field.
+func (q Quota) Narrow(other Quota) Quota {
+	return Quota{MaxBytes: stricter(q.MaxBytes, other.MaxBytes), MaxFiles: stricter(q.MaxFiles, other.MaxFiles)}
+}
+
+func stricter(a, b int64) int64 {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// Quotas are the limits a write is checked against. Owner and Global count
+// the files of all buckets, Bucket only those of the bucket written to.
+type Quotas struct {
+	Owner  Quota
+	Global Quota
+	Bucket Quota
+}
+
+// Usage is what an owner or the whole storage holds. Bytes include older
+// versions and files in the trash, Files counts only files not in the trash.
+type Usage struct {
+	Bytes int64
+	Files int64
+}
+
+// LifecycleRule applies to files whose names start with Prefix: they move to
+// the cold tier ColdAfter and are removed ExpireAfter their last write. Zero
+// durations disable the action.
+type LifecycleRule struct {
+	Prefix      string
+	ExpireAfter time.Duration
+	ColdAfter   time.Duration
 }
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// SearchQuery selects and ranks files. Zero fields do not restrict the
+// search.
+type SearchQuery struct {
+	// Name is matched case-insensitively against the file path: the closer
+	// the match to the base name, the higher the score.
+	Name string
+	// Fuzzy also matches names within a few typos of Name.
+	Fuzzy  bool
+	Prefix string
+	// Tags must all be set on a file.
+	Tags []string
+	// Metadata entries must all be set on a file, an empty value matching
+	// any value of the key.
+	Metadata                    map[string]string
+	MinSize, MaxSize            int64
+	CreatedAfter, CreatedBefore time.Time
+	UpdatedAfter, UpdatedBefore time.Time
+	// Dimension ranges only match files whose dimensions are known.
+	MinWidth, MaxWidth   int
+	MinHeight, MaxHeight int
+	// Offset and Limit select a page of the ranked results.
+	Offset, Limit int
+}
+
+// SearchResult is a file found by a search with its current version and
+// score between 0 and 1.
+type SearchResult struct {
+	File    File
+	Version FileVersion
+	Score   float64
+}
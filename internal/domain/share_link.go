@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// ShareLink grants access to a single file without credentials until it
+// expires, is revoked or runs out of downloads.
+type ShareLink struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	// Bucket is empty for the default bucket.
+	Bucket    string    `json:"bucket,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// MaxDownloads of zero means unlimited.
+	MaxDownloads int  `json:"max_downloads,omitempty"`
+	Downloads    int  `json:"downloads"`
+	Revoked      bool `json:"revoked,omitempty"`
+}
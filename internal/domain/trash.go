@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+// TrashEntry is a deleted file kept for restoring until ExpiresAt.
+type TrashEntry struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,207 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"tagesTest/internal/domain"
+)
+
+type Type int
+
+const (
+	Created Type = iota + 1
+	Updated
+	Deleted
+	// Expired means the file was removed by its TTL or a lifecycle rule.
+	Expired
+	// MovedToCold means a lifecycle rule moved the file to the cold tier.
+	MovedToCold
+)
+
+func (t Type) String() string {
+	switch t {
+	case Created:
+		return "created"
+	case Updated:
+		return "updated"
+	case Deleted:
+		return "deleted"
+	case Expired:
+		return "expired"
+	case MovedToCold:
+		return "moved_to_cold"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a single change of a stored file. Sequence numbers start
+// at 1 and grow by one with every event. They restart with the server, so
+// they only identify an event together with the Epoch of the bus.
+type Event struct {
+	Epoch    string      `json:"epoch"`
+	Sequence uint64      `json:"sequence"`
+	Type     Type        `json:"type"`
+	File     domain.File `json:"file"`
+	Time     time.Time   `json:"time"`
+}
+
+var (
+	// ErrSequenceUnavailable means the requested events are no longer kept
+	// or were issued before a restart; the subscriber has to resync.
+	ErrSequenceUnavailable = errors.New("events after the given sequence are not available")
+	ErrHistoryLost         = fmt.Errorf("%w: history lost, the epoch does not match", ErrSequenceUnavailable)
+	ErrTooManySubscribers  = errors.New("too many subscribers")
+	ErrSlowSubscriber      = errors.New("subscriber fell behind")
+	ErrClosed              = errors.New("event bus closed")
+)
+
+// Bus fans out file events to subscribers and keeps the most recent ones so
+// subscribers can resume after a reconnect.
+type Bus struct {
+	mu             sync.Mutex
+	epoch          string
+	seq            uint64
+	history        []Event
+	historySize    int
+	maxSubscribers int
+	subscribers    map[*Subscription]struct{}
+	closed         bool
+}
+
+func NewBus(historySize, maxSubscribers int) *Bus {
+	return &Bus{
+		epoch:          newEpoch(),
+		historySize:    historySize,
+		maxSubscribers: maxSubscribers,
+		subscribers:    make(map[*Subscription]struct{}),
+	}
+}
+
+func (b *Bus) Publish(typ Type, file domain.File) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.seq++
+	event := Event{Epoch: b.epoch, Sequence: b.seq, Type: typ, File: file, Time: time.Now()}
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			b.drop(sub, ErrSlowSubscriber)
+		}
+	}
+}
+
+// Epoch identifies this run of the bus. Sequence numbers of different
+// epochs are unrelated.
+func (b *Bus) Epoch() string {
+	return b.epoch
+}
+
+// Subscribe delivers every event after sequence after of epoch, replaying
+// kept ones first. after of zero subscribes to new events only, whatever the
+// epoch.
+func (b *Bus) Subscribe(epoch string, after uint64, buffer int) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if b.maxSubscribers > 0 && len(b.subscribers) >= b.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	var replay []Event
+	if after > 0 {
+		if epoch != b.epoch {
+			return nil, ErrHistoryLost
+		}
+		if after > b.seq {
+			return nil, ErrSequenceUnavailable
+		}
+		if after < b.seq {
+			if len(b.history) == 0 || b.history[0].Sequence > after+1 {
+				return nil, ErrSequenceUnavailable
+			}
+			replay = b.history[after+1-b.history[0].Sequence:]
+		}
+	}
+
+	sub := &Subscription{bus: b, events: make(chan Event, buffer+len(replay)), done: make(chan struct{})}
+	for _, event := range replay {
+		sub.events <- event
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// Close ends all subscriptions and ignores further events.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		b.drop(sub, ErrClosed)
+	}
+}
+
+// drop removes sub, the caller holds b.mu.
+func (b *Bus) drop(sub *Subscription, err error) {
+	delete(b.subscribers, sub)
+	sub.err = err
+	close(sub.done)
+}
+
+type Subscription struct {
+	bus    *Bus
+	events chan Event
+	done   chan struct{}
+	err    error
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed when the bus drops the subscription, Err tells why.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) Err() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.err
+}
+
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subscribers[s]; ok {
+		delete(s.bus.subscribers, s)
+		close(s.done)
+	}
+}
+
+func newEpoch() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
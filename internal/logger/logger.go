@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New creates a logger writing in the given format. level may be changed
+// later to adjust the logger at runtime.
+func New(w io.Writer, level *slog.LevelVar, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return lvl, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	return lvl, nil
+}
+
+type loggerKey struct{}
+
+type attrsKey struct{}
+
+type callAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// WithLogger stores l in ctx together with an empty set of call attributes
+// that handlers can fill with AddAttrs.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	ctx = context.WithValue(ctx, loggerKey{}, l)
+	return context.WithValue(ctx, attrsKey{}, &callAttrs{})
+}
+
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// AddAttrs records attributes to be included in the call summary line.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	ca, ok := ctx.Value(attrsKey{}).(*callAttrs)
+	if !ok {
+		return
+	}
+	ca.mu.Lock()
+	ca.attrs = append(ca.attrs, attrs...)
+	ca.mu.Unlock()
+}
+
+func Attrs(ctx context.Context) []slog.Attr {
+	ca, ok := ctx.Value(attrsKey{}).(*callAttrs)
+	if !ok {
+		return nil
+	}
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return append([]slog.Attr(nil), ca.attrs...)
+}
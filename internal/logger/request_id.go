@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const maxRequestIDLength = 128
+
+// RequestID returns incoming when it is a usable request ID, that is at most
+// 128 characters of letters, digits, '.', '_' and '-', and a new random ID
+// otherwise, so that clients cannot put arbitrary text into logs and
+// response headers.
+func RequestID(incoming string) string {
+	if validRequestID(incoming) {
+		return incoming
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
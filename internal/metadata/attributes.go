@@ -0,0 +1,62 @@
+package metadata
+
+import "tagesTest/internal/domain"
+
+// Attributes returns the metadata and tags of filename.
+func (s *Store) Attributes(filename string) domain.Attributes {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[filename]
+	if !ok {
+		return domain.Attributes{}
+	}
+	return record.Attributes.Clone()
+}
+
+// SetAttributes replaces the metadata and tags of filename. Nil metadata or
+// tags are left as they are.
+func (s *Store) SetAttributes(filename string, metadata map[string]string, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[filename]
+	if !ok {
+		return domain.ErrFileNotFound
+	}
+	if metadata == nil && tags == nil {
+		return nil
+	}
+	if metadata != nil {
+		record.Metadata = metadata
+		if len(metadata) == 0 {
+			record.Metadata = nil
+		}
+	}
+	if tags != nil {
+		record.Tags = domain.SortTags(tags)
+		if len(tags) == 0 {
+			record.Tags = nil
+		}
+	}
+	return s.save(fileKey(filename))
+}
+
+// UpdateAttributes applies update to the attributes of filename and returns
+// the result. An update leaving invalid attributes fails with
+// domain.ErrInvalidMetadata and changes nothing.
+func (s *Store) UpdateAttributes(filename string, update domain.AttributesUpdate) (domain.Attributes, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[filename]
+	if !ok {
+		return domain.Attributes{}, domain.ErrFileNotFound
+	}
+	updated := update.Apply(record.Attributes)
+	if err := updated.Validate(); err != nil {
+		return domain.Attributes{}, err
+	}
+	record.Attributes = updated
+	return updated.Clone(), s.save(fileKey(filename))
+}
@@ -0,0 +1,46 @@
+package metadata
+
+import (
+	"slices"
+	"strings"
+
+	"tagesTest/internal/domain"
+)
+
+// PutBucket records a new bucket.
+func (s *Store) PutBucket(bucket domain.Bucket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Buckets[bucket.Name]; ok {
+		return domain.ErrBucketExists
+	}
+	s.state.Buckets[bucket.Name] = &bucket
+	return s.save(bucketKey(bucket.Name))
+}
+
+// Buckets returns all buckets ordered by name.
+func (s *Store) Buckets() []domain.Bucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets := make([]domain.Bucket, 0, len(s.state.Buckets))
+	for _, bucket := range s.state.Buckets {
+		buckets = append(buckets, *bucket)
+	}
+	slices.SortFunc(buckets, func(a, b domain.Bucket) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return buckets
+}
+
+func (s *Store) DeleteBucket(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Buckets[name]; !ok {
+		return domain.ErrBucketNotFound
+	}
+	delete(s.state.Buckets, name)
+	return s.save(bucketKey(name))
+}
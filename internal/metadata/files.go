@@ -0,0 +1,239 @@
+package metadata
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"tagesTest/internal/domain"
+)
+
+// fileRecord tracks the current version of a file and the versions it
+// replaced, oldest first.
+type fileRecord struct {
+	Current domain.FileVersion   `json:"current"`
+	Older   []domain.FileVersion `json:"older,omitempty"`
+	// ExpiresAt is set for files uploaded with a TTL.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Owner is charged for the file. Files stored before owners were
+	// recorded have none.
+	Owner string `json:"owner,omitempty"`
+	domain.Attributes
+}
+
+// CurrentVersion returns the latest version of filename, if the file is known.
+func (s *Store) CurrentVersion(filename string) (domain.FileVersion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[filename]
+	if !ok {
+		return domain.FileVersion{}, false
+	}
+	return record.Current, true
+}
+
+// Versions returns all versions of filename, newest first.
+func (s *Store) Versions(filename string) ([]domain.FileVersion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[filename]
+	if !ok {
+		return nil, false
+	}
+	versions := make([]domain.FileVersion, 0, len(record.Older)+1)
+	current := record.Current
+	current.Latest = true
+	versions = append(versions, current)
+	for i := len(record.Older) - 1; i >= 0; i-- {
+		versions = append(versions, record.Older[i])
+	}
+	return versions, true
+}
+
+// VersionedFiles returns the names of files that have older versions.
+func (s *Store) VersionedFiles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for name, record := range s.state.Files {
+		if len(record.Older) > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// PutFile records a newly created file of owner, forgetting any earlier
+// history.
+func (s *Store) PutFile(filename string, version domain.FileVersion, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.change(filename, func(record *fileRecord) {
+		*record = fileRecord{Current: version, Owner: owner}
+	})
+	return s.save(fileKey(filename))
+}
+
+// AddVersion makes current the latest version of filename and keeps previous
+// as an older one. owner is recorded if the file has none yet.
+func (s *Store) AddVersion(filename string, previous, current domain.FileVersion, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.change(filename, func(record *fileRecord) {
+		record.Older = append(record.Older, previous)
+		record.Current = current
+		if record.Owner == "" {
+			record.Owner = owner
+		}
+	})
+	return s.save(fileKey(filename))
+}
+
+// SetCurrentVersion makes current the latest version of filename, dropping
+// the previous one while keeping older versions. owner is recorded if the
+// file has none yet.
+func (s *Store) SetCurrentVersion(filename string, current domain.FileVersion, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.change(filename, func(record *fileRecord) {
+		record.Current = current
+		if record.Owner == "" {
+			record.Owner = owner
+		}
+	})
+	return s.save(fileKey(filename))
+}
+
+// SetExpiry makes filename expire at expiresAt, or never if it is zero.
+func (s *Store) SetExpiry(filename string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[filename]
+	if !ok {
+		return domain.ErrFileNotFound
+	}
+	if expiresAt.IsZero() {
+		if record.ExpiresAt == nil {
+			return nil
+		}
+		record.ExpiresAt = nil
+	} else {
+		record.ExpiresAt = &expiresAt
+	}
+	return s.save(fileKey(filename))
+}
+
+// Expiry returns when filename expires, if it has a TTL.
+func (s *Store) Expiry(filename string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[filename]
+	if !ok || record.ExpiresAt == nil {
+		return time.Time{}, false
+	}
+	return *record.ExpiresAt, true
+}
+
+// ExpiredFiles returns the names of files whose TTL ran out by now.
+func (s *Store) ExpiredFiles(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for name, record := range s.state.Files {
+		if record.ExpiresAt != nil && !record.ExpiresAt.After(now) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// RenameFile moves the record of from to to, replacing any record of to.
+func (s *Store) RenameFile(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[from]
+	if !ok {
+		return nil
+	}
+	if replaced, ok := s.state.Files[to]; ok {
+		s.account(replaced, -1, -1)
+	}
+	delete(s.state.Files, from)
+	s.state.Files[to] = record
+	return s.save(fileKey(from), fileKey(to))
+}
+
+// CopyFile records to as a new file of owner holding version, with the
+// expiry and attributes of from.
+func (s *Store) CopyFile(from, to string, version domain.FileVersion, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expiresAt *time.Time
+	var attributes domain.Attributes
+	if source, ok := s.state.Files[from]; ok {
+		expiresAt = source.ExpiresAt
+		attributes = source.Attributes.Clone()
+	}
+	s.change(to, func(record *fileRecord) {
+		*record = fileRecord{Current: version, ExpiresAt: expiresAt, Owner: owner, Attributes: attributes}
+	})
+	return s.save(fileKey(to))
+}
+
+// RenameFolder moves the records of files in folder from to folder to.
+func (s *Store) RenameFolder(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []key
+	for name, record := range s.state.Files {
+		if rest, ok := strings.CutPrefix(name, from+"/"); ok {
+			delete(s.state.Files, name)
+			s.state.Files[to+"/"+rest] = record
+			changed = append(changed, fileKey(name), fileKey(to+"/"+rest))
+		}
+	}
+	return s.save(changed...)
+}
+
+// RemoveVersions forgets the given older versions of filename.
+func (s *Store) RemoveVersions(filename string, versions []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Files[filename]; !ok {
+		return nil
+	}
+	s.change(filename, func(record *fileRecord) {
+		record.Older = slices.DeleteFunc(record.Older, func(v domain.FileVersion) bool {
+			return slices.Contains(versions, v.Version)
+		})
+	})
+	return s.save(fileKey(filename))
+}
+
+func (s *Store) DeleteFile(filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[filename]
+	if !ok {
+		return nil
+	}
+	s.account(record, -1, -1)
+	delete(s.state.Files, filename)
+	return s.save(fileKey(filename))
+}
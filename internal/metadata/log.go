@@ -0,0 +1,211 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// compactAfter is the number of log entries written before the log may be
+// folded into the snapshot.
+const compactAfter = 1024
+
+// Kinds of records a change can touch.
+const (
+	kindFile        = "file"
+	kindTrash       = "trash"
+	kindShareLink   = "share_link"
+	kindBucket      = "bucket"
+	kindShareSecret = "share_secret"
+)
+
+// key names one record of the state.
+type key struct {
+	Kind string `json:"kind"`
+	Name string `json:"name,omitempty"`
+}
+
+func fileKey(filename string) key { return key{Kind: kindFile, Name: filename} }
+func trashKey(id string) key      { return key{Kind: kindTrash, Name: id} }
+func shareLinkKey(id string) key  { return key{Kind: kindShareLink, Name: id} }
+func bucketKey(name string) key   { return key{Kind: kindBucket, Name: name} }
+
+var shareSecretKey = key{Kind: kindShareSecret}
+
+// change is the new value of one record. A change without a value removes
+// the record.
+type change struct {
+	key
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// changeLog holds the changes made since the snapshot was written, one line
+// per save. Every line sets records to their whole new value, so replaying
+// a line twice is harmless.
+type changeLog struct {
+	path    string
+	file    *os.File
+	entries int
+	torn    bool
+}
+
+// errTornLog is returned by append once a failed write could not be cut off.
+var errTornLog = errors.New("change log ends with a torn line")
+
+// lookup returns the value of the record k names, if it exists.
+func (st *state) lookup(k key) (any, bool) {
+	switch k.Kind {
+	case kindFile:
+		record, ok := st.Files[k.Name]
+		return record, ok
+	case kindTrash:
+		record, ok := st.Trash[k.Name]
+		return record, ok
+	case kindShareLink:
+		record, ok := st.ShareLinks[k.Name]
+		return record, ok
+	case kindBucket:
+		record, ok := st.Buckets[k.Name]
+		return record, ok
+	case kindShareSecret:
+		return st.ShareSecret, len(st.ShareSecret) > 0
+	}
+	return nil, false
+}
+
+// apply sets the record c names to its value or removes it.
+func (st *state) apply(c change) error {
+	if c.Value == nil {
+		switch c.Kind {
+		case kindFile:
+			delete(st.Files, c.Name)
+		case kindTrash:
+			delete(st.Trash, c.Name)
+		case kindShareLink:
+			delete(st.ShareLinks, c.Name)
+		case kindBucket:
+			delete(st.Buckets, c.Name)
+		case kindShareSecret:
+			st.ShareSecret = nil
+		}
+		return nil
+	}
+	switch c.Kind {
+	case kindFile:
+		return decodeInto(c.Value, st.Files, c.Name)
+	case kindTrash:
+		return decodeInto(c.Value, st.Trash, c.Name)
+	case kindShareLink:
+		return decodeInto(c.Value, st.ShareLinks, c.Name)
+	case kindBucket:
+		return decodeInto(c.Value, st.Buckets, c.Name)
+	case kindShareSecret:
+		return json.Unmarshal(c.Value, &st.ShareSecret)
+	}
+	return fmt.Errorf("unknown record kind %q", c.Kind)
+}
+
+func decodeInto[T any](data []byte, records map[string]*T, name string) error {
+	record := new(T)
+	if err := json.Unmarshal(data, record); err != nil {
+		return err
+	}
+	records[name] = record
+	return nil
+}
+
+// replay applies the changes in the log to st. A line cut short by a crash
+// ends the replay and is cut off, so later changes are not appended after it.
+func (l *changeLog) replay(st *state) error {
+	file, err := os.OpenFile(l.path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				return file.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var changes []change
+		if err := json.Unmarshal(line, &changes); err != nil {
+			return file.Truncate(offset)
+		}
+		for _, c := range changes {
+			if err := st.apply(c); err != nil {
+				return fmt.Errorf("failed to apply %s %q: %w", c.Kind, c.Name, err)
+			}
+		}
+		offset += int64(len(line))
+		l.entries += len(changes)
+	}
+}
+
+// append writes changes to the end of the log as one line. A failed write is
+// cut off again, so the next line does not follow a torn one. If that fails
+// too, the log is marked torn and refuses further lines until reset.
+func (l *changeLog) append(changes []change) error {
+	if l.torn {
+		return errTornLog
+	}
+	if l.file == nil {
+		if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		l.file = file
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		if truncErr := l.file.Truncate(info.Size()); truncErr != nil {
+			l.file.Close()
+			l.file = nil
+			l.torn = true
+			return errors.Join(err, truncErr)
+		}
+		return err
+	}
+	l.entries += len(changes)
+	return nil
+}
+
+// reset empties the log once its changes are in the snapshot.
+func (l *changeLog) reset() error {
+	l.entries = 0
+	if l.file == nil {
+		err := os.Remove(l.path)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			l.torn = false
+			return nil
+		}
+		return err
+	}
+	return l.file.Truncate(0)
+}
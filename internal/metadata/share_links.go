@@ -0,0 +1,103 @@
+package metadata
+
+import (
+	"crypto/rand"
+	"time"
+
+	"tagesTest/internal/domain"
+)
+
+const shareSecretSize = 32
+
+// ShareSecret returns the key used to sign share links, generating and
+// persisting one on first use.
+func (s *Store) ShareSecret() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.state.ShareSecret) > 0 {
+		return s.state.ShareSecret, nil
+	}
+	secret := make([]byte, shareSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	s.state.ShareSecret = secret
+	if err := s.save(shareSecretKey); err != nil {
+		s.state.ShareSecret = nil
+		return nil, err
+	}
+	return secret, nil
+}
+
+// PutShareLink stores link and drops links that have expired.
+func (s *Store) PutShareLink(link domain.ShareLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := []key{shareLinkKey(link.ID)}
+	now := time.Now()
+	for id, record := range s.state.ShareLinks {
+		if now.After(record.ExpiresAt) {
+			delete(s.state.ShareLinks, id)
+			changed = append(changed, shareLinkKey(id))
+		}
+	}
+	s.state.ShareLinks[link.ID] = &link
+	return s.save(changed...)
+}
+
+func (s *Store) ShareLink(id string) (domain.ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.ShareLinks[id]
+	if !ok {
+		return domain.ShareLink{}, domain.ErrShareLinkNotFound
+	}
+	return *record, nil
+}
+
+func (s *Store) RevokeShareLink(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.ShareLinks[id]
+	if !ok {
+		return domain.ErrShareLinkNotFound
+	}
+	if record.Revoked {
+		return nil
+	}
+	record.Revoked = true
+	if err := s.save(shareLinkKey(id)); err != nil {
+		record.Revoked = false
+		return err
+	}
+	return nil
+}
+
+// UseShareLink counts a download through the link, failing if the link can
+// no longer be used.
+func (s *Store) UseShareLink(id string, now time.Time) (domain.ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.ShareLinks[id]
+	switch {
+	case !ok:
+		return domain.ShareLink{}, domain.ErrShareLinkInvalid
+	case record.Revoked:
+		return domain.ShareLink{}, domain.ErrShareLinkRevoked
+	case now.After(record.ExpiresAt):
+		return domain.ShareLink{}, domain.ErrShareLinkExpired
+	case record.MaxDownloads > 0 && record.Downloads >= record.MaxDownloads:
+		return domain.ShareLink{}, domain.ErrShareLinkExhausted
+	}
+	record.Downloads++
+	if err := s.save(shareLinkKey(id)); err != nil {
+		record.Downloads--
+		return domain.ShareLink{}, err
+	}
+	return *record, nil
+}
@@ -0,0 +1,151 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"tagesTest/internal/domain"
+)
+
+// state is everything the store keeps. The snapshot holds it as a whole;
+// changes made since are in the log.
+type state struct {
+	ShareSecret []byte                       `json:"share_secret,omitempty"`
+	ShareLinks  map[string]*domain.ShareLink `json:"share_links,omitempty"`
+	Files       map[string]*fileRecord       `json:"files,omitempty"`
+	Trash       map[string]*trashRecord      `json:"trash,omitempty"`
+	Buckets     map[string]*domain.Bucket    `json:"buckets,omitempty"`
+}
+
+func (st *state) records() int {
+	return len(st.ShareLinks) + len(st.Files) + len(st.Trash) + len(st.Buckets) + 1
+}
+
+// Store keeps file metadata that does not belong to the file contents in a
+// JSON snapshot and a log of the changes made since, next to it with the
+// .log suffix. A change costs one appended line however many files there
+// are; the log is folded into the snapshot once it outgrows the state.
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	state state
+	log   changeLog
+	usage usage
+}
+
+// Open loads the store from path and its log. A missing file yields an
+// empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, log: changeLog{path: path + ".log"}}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.state); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata file %s: %w", path, err)
+		}
+	}
+	s.init()
+	if err := s.log.replay(&s.state); err != nil {
+		return nil, fmt.Errorf("failed to replay metadata log %s: %w", s.log.path, err)
+	}
+	s.recount()
+	return s, nil
+}
+
+// Close closes the log.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log.file == nil {
+		return nil
+	}
+	err := s.log.file.Close()
+	s.log.file = nil
+	return err
+}
+
+func (s *Store) init() {
+	if s.state.ShareLinks == nil {
+		s.state.ShareLinks = make(map[string]*domain.ShareLink)
+	}
+	if s.state.Files == nil {
+		s.state.Files = make(map[string]*fileRecord)
+	}
+	if s.state.Trash == nil {
+		s.state.Trash = make(map[string]*trashRecord)
+	}
+	if s.state.Buckets == nil {
+		s.state.Buckets = make(map[string]*domain.Bucket)
+	}
+}
+
+// save appends the current values of the records keys name to the log. The
+// caller holds s.mu.
+func (s *Store) save(keys ...key) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	changes := make([]change, 0, len(keys))
+	for _, k := range keys {
+		c := change{key: k}
+		if value, ok := s.state.lookup(k); ok {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			c.Value = data
+		}
+		changes = append(changes, c)
+	}
+	if err := s.log.append(changes); err != nil {
+		if !s.log.torn {
+			return err
+		}
+		// the log cannot take more lines, so the whole state goes into the
+		// snapshot instead
+		return s.compact()
+	}
+	if s.log.entries >= compactAfter && s.log.entries >= 4*s.state.records() {
+		// the change is in the log already, so a failed compaction only
+		// leaves a longer log to replay and is retried on the next save
+		_ = s.compact()
+	}
+	return nil
+}
+
+// compact writes the state into a temporary file, renames it over the
+// snapshot, so a crash never leaves a truncated file, and empties the log.
+// The caller holds s.mu.
+func (s *Store) compact() error {
+	data, err := json.MarshalIndent(&s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, "."+filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), s.path); err != nil {
+		return err
+	}
+	return s.log.reset()
+}
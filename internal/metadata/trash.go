@@ -0,0 +1,108 @@
+package metadata
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"tagesTest/internal/domain"
+)
+
+// trashRecord keeps the version history of a deleted file so that restoring
+// it brings the history back too.
+type trashRecord struct {
+	Entry domain.TrashEntry `json:"entry"`
+	File  *fileRecord       `json:"file,omitempty"`
+}
+
+// TrashFile records entry and moves the history of its file into the trash.
+func (s *Store) TrashFile(entry domain.TrashEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.state.Files[entry.Filename]
+	if record != nil {
+		// the bytes stay charged until the entry is purged
+		s.account(record, 0, -1)
+	}
+	s.state.Trash[entry.ID] = &trashRecord{Entry: entry, File: record}
+	delete(s.state.Files, entry.Filename)
+	return s.save(trashKey(entry.ID), fileKey(entry.Filename))
+}
+
+func (s *Store) TrashEntry(id string) (domain.TrashEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Trash[id]
+	if !ok {
+		return domain.TrashEntry{}, domain.ErrTrashEntryNotFound
+	}
+	return record.Entry, nil
+}
+
+// TrashEntries returns the trash, most recently deleted first.
+func (s *Store) TrashEntries() []domain.TrashEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]domain.TrashEntry, 0, len(s.state.Trash))
+	for _, record := range s.state.Trash {
+		entries = append(entries, record.Entry)
+	}
+	slices.SortFunc(entries, func(a, b domain.TrashEntry) int {
+		if c := b.DeletedAt.Compare(a.DeletedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return entries
+}
+
+// ExpiredTrash returns the IDs of entries that expired by now.
+func (s *Store) ExpiredTrash(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id, record := range s.state.Trash {
+		if !record.Entry.ExpiresAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// RestoreTrash removes entry id from the trash and gives its history back to
+// the file.
+func (s *Store) RestoreTrash(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Trash[id]
+	if !ok {
+		return domain.ErrTrashEntryNotFound
+	}
+	if record.File != nil {
+		s.account(record.File, 0, 1)
+		s.state.Files[record.Entry.Filename] = record.File
+	}
+	delete(s.state.Trash, id)
+	return s.save(trashKey(id), fileKey(record.Entry.Filename))
+}
+
+func (s *Store) DeleteTrash(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Trash[id]
+	if !ok {
+		return domain.ErrTrashEntryNotFound
+	}
+	if record.File != nil {
+		s.account(record.File, -1, 0)
+	}
+	delete(s.state.Trash, id)
+	return s.save(trashKey(id))
+}
@@ -0,0 +1,84 @@
+package metadata
+
+import "tagesTest/internal/domain"
+
+// usage is derived from the file and trash records: it is rebuilt on Open
+// and kept in step by every change, never written to disk.
+type usage struct {
+	owners map[string]*domain.Usage
+	total  domain.Usage
+}
+
+func (s *Store) recount() {
+	s.usage = usage{owners: make(map[string]*domain.Usage)}
+	for _, record := range s.state.Files {
+		s.account(record, 1, 1)
+	}
+	for _, record := range s.state.Trash {
+		if record.File != nil {
+			s.account(record.File, 1, 0)
+		}
+	}
+}
+
+// account adds the bytes of record times sign and files to the usage of its
+// owner and the total. The caller holds s.mu.
+func (s *Store) account(record *fileRecord, sign, files int64) {
+	bytes := record.Current.Size
+	for _, v := range record.Older {
+		bytes += v.Size
+	}
+	owner, ok := s.usage.owners[record.Owner]
+	if !ok {
+		owner = &domain.Usage{}
+		s.usage.owners[record.Owner] = owner
+	}
+	owner.Bytes += sign * bytes
+	owner.Files += files
+	s.usage.total.Bytes += sign * bytes
+	s.usage.total.Files += files
+}
+
+// change applies fn to the record of filename, creating it if needed, and
+// updates usage accordingly. The caller holds s.mu.
+func (s *Store) change(filename string, fn func(record *fileRecord)) {
+	record, ok := s.state.Files[filename]
+	if ok {
+		s.account(record, -1, -1)
+	} else {
+		record = &fileRecord{}
+		s.state.Files[filename] = record
+	}
+	fn(record)
+	s.account(record, 1, 1)
+}
+
+// Usage returns what owner holds.
+func (s *Store) Usage(owner string) domain.Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if usage, ok := s.usage.owners[owner]; ok {
+		return *usage
+	}
+	return domain.Usage{}
+}
+
+// TotalUsage returns what all owners hold together.
+func (s *Store) TotalUsage() domain.Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage.total
+}
+
+// Owner returns who is charged for filename, if anyone.
+func (s *Store) Owner(filename string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.state.Files[filename]
+	if !ok || record.Owner == "" {
+		return "", false
+	}
+	return record.Owner, true
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"tagesTest/internal/domain"
+	"tagesTest/internal/events"
+)
+
+// UpdateAttributes applies update to the metadata and tags of filename and
+// returns the result.
+func (r *FileRepository) UpdateAttributes(filename string, update domain.AttributesUpdate) (domain.Attributes, error) {
+	unlock := r.locks.lock(filename)
+	defer unlock()
+
+	current, err := r.currentVersion(filename)
+	if err != nil {
+		return domain.Attributes{}, err
+	}
+	if _, ok := r.metadata.CurrentVersion(filename); !ok {
+		// files stored before versioning have no record to keep them in yet
+		if err := r.metadata.SetCurrentVersion(filename, current, ""); err != nil {
+			return domain.Attributes{}, err
+		}
+	}
+	attributes, err := r.metadata.UpdateAttributes(filename, update)
+	if err != nil {
+		return domain.Attributes{}, err
+	}
+	r.publish(events.Updated, filename)
+	return attributes, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"os"
+
+	"tagesTest/internal/domain"
+	"tagesTest/internal/metadata"
+	"tagesTest/internal/storage"
+)
+
+// BucketLayout opens buckets as storages of their own in storage.BucketDir
+// of the storage directories, each with its metadata in a file next to it.
+// Events of all buckets go to the bus of the default bucket, and quotas are
+// checked against the usage of all of them.
+type BucketLayout struct {
+	storageDir     string
+	coldStorageDir string
+	main           *FileRepository
+}
+
+// NewBucketLayout creates the layout for buckets next to main, the
+// repository of the default bucket. coldStorageDir is empty when there is
+// no cold tier.
+func NewBucketLayout(main *FileRepository, storageDir, coldStorageDir string) *BucketLayout {
+	return &BucketLayout{storageDir: storageDir, coldStorageDir: coldStorageDir, main: main}
+}
+
+// Open returns the repository of bucket, removing uploads it left behind
+// when the server last stopped.
+func (l *BucketLayout) Open(bucket string) (*FileRepository, error) {
+	dir := storage.BucketDir(l.storageDir, bucket)
+	disk := storage.NewDiskStorage(dir)
+	if err := disk.RemovePartialUploads(); err != nil {
+		return nil, err
+	}
+	var fileStorage storage.FileStorageInterface = disk
+	if l.coldStorageDir != "" {
+		cold := storage.NewDiskStorage(storage.BucketDir(l.coldStorageDir, bucket))
+		if err := cold.RemovePartialUploads(); err != nil {
+			return nil, err
+		}
+		fileStorage = storage.NewTieredStorage(disk, cold)
+	}
+	store, err := metadata.Open(dir + ".json")
+	if err != nil {
+		return nil, err
+	}
+	repo := newFileRepository(fileStorage, store, l.main.bus, l.main.quota)
+	repo.bucket = bucket
+	return repo, nil
+}
+
+// Remove deletes everything stored in bucket.
+func (l *BucketLayout) Remove(bucket string) error {
+	dir := storage.BucketDir(l.storageDir, bucket)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if l.coldStorageDir != "" {
+		if err := os.RemoveAll(storage.BucketDir(l.coldStorageDir, bucket)); err != nil {
+			return err
+		}
+	}
+	for _, path := range []string{dir + ".json", dir + ".json.log"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the metadata log of a bucket that is about to be removed
+// and stops counting its usage.
+func (r *FileRepository) Close() error {
+	r.quota.remove(r.metadata)
+	return r.metadata.Close()
+}
+
+func (r *FileRepository) CreateBucket(bucket domain.Bucket) error {
+	return r.metadata.PutBucket(bucket)
+}
+
+func (r *FileRepository) ListBuckets() []domain.Bucket {
+	return r.metadata.Buckets()
+}
+
+func (r *FileRepository) DeleteBucket(name string) error {
+	return r.metadata.DeleteBucket(name)
+}
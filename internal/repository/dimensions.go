@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// dimensions reads the width and height of the image stored under filename
+// from its header. Formats the standard library cannot decode give zeros.
+func (r *FileRepository) dimensions(filename string) (int, int) {
+	file, err := r.storage.Get(filename)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
@@ -1,27 +1,369 @@
 package repository
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
+	"strconv"
+	"strings"
 	"tagesTest/internal/domain"
+	"tagesTest/internal/events"
+	"tagesTest/internal/metadata"
 	"tagesTest/internal/storage"
+	"time"
 )
 
+// FileRepository publishes an event on bus for every change it makes.
 type FileRepository struct {
-	storage storage.FileStorageInterface
+	storage  storage.FileStorageInterface
+	metadata *metadata.Store
+	bus      *events.Bus
+	locks    fileLocks
+	quota    *quotaTracker
+	index    searchIndex
+	// bucket is empty for the default bucket
+	bucket string
 }
 
-func NewFileRepository(storage storage.FileStorageInterface) *FileRepository {
-	return &FileRepository{storage: storage}
+// NewFileRepository creates the repository of the default bucket. Quotas
+// of the repositories of other buckets, opened through a BucketLayout, are
+// shared with it.
+func NewFileRepository(storage storage.FileStorageInterface, metadata *metadata.Store, bus *events.Bus) *FileRepository {
+	return newFileRepository(storage, metadata, bus, newQuotaTracker())
 }
 
-func (r *FileRepository) SaveFile(filename string, reader io.Reader) error {
-	return r.storage.Save(filename, reader)
+func newFileRepository(
+	storage storage.FileStorageInterface, metadata *metadata.Store, bus *events.Bus, quota *quotaTracker,
+) *FileRepository {
+	quota.add(metadata)
+	return &FileRepository{storage: storage, metadata: metadata, bus: bus, quota: quota}
 }
 
+// WriteFile stores reader under filename as opts.Mode allows. The mode is
+// checked under the file's lock before reader is consumed, so concurrent
+// writers of the same file cannot both pass it.
+func (r *FileRepository) WriteFile(filename string, reader io.Reader, opts domain.WriteOptions) (domain.FileVersion, error) {
+	unlock := r.locks.lock(filename)
+	defer unlock()
+
+	current, err := r.currentVersion(filename)
+	exists := err == nil
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		return domain.FileVersion{}, err
+	}
+
+	switch opts.Mode {
+	case domain.WriteCreateOnly:
+		if exists {
+			return domain.FileVersion{}, domain.ErrFileExists
+		}
+	case domain.WriteOverwriteIfMatch:
+		if !exists {
+			return domain.FileVersion{}, domain.ErrPreconditionFailed
+		}
+		if err := r.checkMatch(filename, current, opts); err != nil {
+			return domain.FileVersion{}, err
+		}
+	}
+
+	// writes to an existing file are charged to whoever created it
+	if owner, ok := r.metadata.Owner(filename); ok && exists {
+		opts.Owner = owner
+	}
+	if !exists {
+		if err := r.quota.reserveFile(r.metadata, opts.Owner, opts.Quotas); err != nil {
+			return domain.FileVersion{}, err
+		}
+		defer r.quota.releaseFile(r.metadata, opts.Owner)
+	}
+	if opts.Quotas != (domain.Quotas{}) {
+		limited := &quotaReader{
+			src:     reader,
+			tracker: r.quota,
+			store:   r.metadata,
+			owner:   opts.Owner,
+			quotas:  opts.Quotas,
+		}
+		if _, ok := r.metadata.CurrentVersion(filename); ok && exists && !opts.KeepVersion {
+			limited.credit = current.Size
+		}
+		defer limited.release()
+		reader = limited
+	}
+
+	if !exists {
+		return r.saveFile(filename, reader, opts)
+	}
+	return r.replaceFile(filename, reader, current, opts)
+}
+
+// checkMatch compares the current version of filename with the one the
+// writer expects.
+func (r *FileRepository) checkMatch(filename string, current domain.FileVersion, opts domain.WriteOptions) error {
+	if opts.IfGeneration != 0 && opts.IfGeneration != current.Version {
+		return domain.ErrPreconditionFailed
+	}
+	if opts.IfChecksum == "" {
+		return nil
+	}
+	checksum := current.Checksum
+	if checksum == "" {
+		// files stored before checksums were recorded are hashed on demand
+		var err error
+		if checksum, err = r.checksum(filename); err != nil {
+			return err
+		}
+	}
+	if !strings.EqualFold(opts.IfChecksum, checksum) {
+		return domain.ErrPreconditionFailed
+	}
+	return nil
+}
+
+func (r *FileRepository) checksum(filename string) (string, error) {
+	file, err := r.storage.Get(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (r *FileRepository) saveFile(filename string, reader io.Reader, opts domain.WriteOptions) (domain.FileVersion, error) {
+	hash := sha256.New()
+	n, err := r.storage.Save(filename, io.TeeReader(reader, hash))
+	if err != nil {
+		return domain.FileVersion{}, err
+	}
+	version := domain.FileVersion{Version: 1, Size: n, Checksum: hex.EncodeToString(hash.Sum(nil)), CreatedAt: time.Now()}
+	version.Width, version.Height = r.dimensions(filename)
+	if err := r.metadata.PutFile(filename, version, opts.Owner); err != nil {
+		return version, err
+	}
+	if err := r.metadata.SetExpiry(filename, expiry(version.CreatedAt, opts.TTL)); err != nil {
+		return version, err
+	}
+	if err := r.metadata.SetAttributes(filename, opts.Metadata, opts.Tags); err != nil {
+		return version, err
+	}
+	r.publish(events.Created, filename)
+	return version, nil
+}
+
+// replaceFile makes reader the next version of filename, keeping the current
+// content as an older version if opts asks for it.
+func (r *FileRepository) replaceFile(
+	filename string, reader io.Reader, current domain.FileVersion, opts domain.WriteOptions,
+) (domain.FileVersion, error) {
+	var keep string
+	if opts.KeepVersion {
+		keep = strconv.FormatInt(current.Version, 10)
+	}
+	hash := sha256.New()
+	n, err := r.storage.Replace(filename, io.TeeReader(reader, hash), keep)
+	if err != nil {
+		return domain.FileVersion{}, err
+	}
+	next := domain.FileVersion{
+		Version:   current.Version + 1,
+		Size:      n,
+		Checksum:  hex.EncodeToString(hash.Sum(nil)),
+		CreatedAt: time.Now(),
+	}
+	next.Width, next.Height = r.dimensions(filename)
+	if opts.KeepVersion {
+		err = r.metadata.AddVersion(filename, current, next, opts.Owner)
+	} else {
+		err = r.metadata.SetCurrentVersion(filename, next, opts.Owner)
+	}
+	if err != nil {
+		return next, err
+	}
+	if err := r.metadata.SetExpiry(filename, expiry(next.CreatedAt, opts.TTL)); err != nil {
+		return next, err
+	}
+	if err := r.metadata.SetAttributes(filename, opts.Metadata, opts.Tags); err != nil {
+		return next, err
+	}
+	r.publish(events.Updated, filename)
+
+	retention := opts.Retention
+	if opts.KeepVersion && (retention.KeepLast > 0 || retention.MaxAge > 0) {
+		if _, err := r.pruneVersions(filename, retention); err != nil {
+			return next, err
+		}
+	}
+	return next, nil
+}
+
+// expiry returns when a file written at writtenAt with ttl expires, or zero
+// if it does not.
+func expiry(writtenAt time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return writtenAt.Add(ttl)
+}
+
+// currentVersion returns the latest version of filename. Files stored before
+// versioning existed have no record and count as version 1.
+func (r *FileRepository) currentVersion(filename string) (domain.FileVersion, error) {
+	if current, ok := r.metadata.CurrentVersion(filename); ok {
+		return current, nil
+	}
+	info, err := r.storage.Stat(filename)
+	if err != nil {
+		return domain.FileVersion{}, err
+	}
+	return domain.FileVersion{Version: 1, Size: info.Size, CreatedAt: info.UpdatedAt}, nil
+}
+
+// ListVersions returns all versions of filename, newest first.
+func (r *FileRepository) ListVersions(filename string) ([]domain.FileVersion, error) {
+	if versions, ok := r.metadata.Versions(filename); ok {
+		return versions, nil
+	}
+	current, err := r.currentVersion(filename)
+	if err != nil {
+		return nil, err
+	}
+	current.Latest = true
+	return []domain.FileVersion{current}, nil
+}
+
+// GetFileVersion opens the given version of filename.
+func (r *FileRepository) GetFileVersion(filename string, version int64) (io.ReadCloser, error) {
+	current, err := r.currentVersion(filename)
+	if err != nil {
+		return nil, err
+	}
+	if version == current.Version {
+		return r.storage.Get(filename)
+	}
+	return r.storage.GetVersion(filename, strconv.FormatInt(version, 10))
+}
+
+// PruneVersions removes older versions of filename beyond retention and
+// returns how many were removed.
+func (r *FileRepository) PruneVersions(filename string, retention domain.VersionRetention) (int, error) {
+	unlock := r.locks.lock(filename)
+	defer unlock()
+	return r.pruneVersions(filename, retention)
+}
+
+// VersionedFiles returns the names of files with older versions.
+func (r *FileRepository) VersionedFiles() []string {
+	return r.metadata.VersionedFiles()
+}
+
+func (r *FileRepository) pruneVersions(filename string, retention domain.VersionRetention) (int, error) {
+	versions, ok := r.metadata.Versions(filename)
+	if !ok {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-retention.MaxAge)
+	var removed []int64
+	// versions[0] is the latest one, which is never pruned
+	for i, v := range versions[1:] {
+		if (retention.KeepLast > 0 && i >= retention.KeepLast) ||
+			(retention.MaxAge > 0 && v.CreatedAt.Before(cutoff)) {
+			err := r.storage.DeleteVersion(filename, strconv.FormatInt(v.Version, 10))
+			if err != nil && !errors.Is(err, domain.ErrVersionNotFound) {
+				return len(removed), err
+			}
+			removed = append(removed, v.Version)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	return len(removed), r.metadata.RemoveVersions(filename, removed)
+}
+
+// ListFiles returns all files with their attributes.
 func (r *FileRepository) ListFiles() ([]domain.File, error) {
-	return r.storage.List()
+	files, err := r.storage.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		files[i].Attributes = r.metadata.Attributes(files[i].Filename)
+	}
+	return files, nil
 }
 
 func (r *FileRepository) GetFile(filename string) (io.ReadCloser, error) {
 	return r.storage.Get(filename)
 }
+
+func (r *FileRepository) StatFile(filename string) (domain.File, error) {
+	info, err := r.storage.Stat(filename)
+	if err != nil {
+		return info, err
+	}
+	info.Attributes = r.metadata.Attributes(filename)
+	return info, nil
+}
+
+func (r *FileRepository) DeleteFile(filename string) error {
+	unlock := r.locks.lock(filename)
+	defer unlock()
+
+	info, err := r.storage.Stat(filename)
+	if err != nil {
+		info = domain.File{Filename: filename}
+	}
+	if err := r.storage.Delete(filename); err != nil {
+		return err
+	}
+	r.emit(events.Deleted, info)
+	return r.metadata.DeleteFile(filename)
+}
+
+func (r *FileRepository) Subscribe(epoch string, after uint64, buffer int) (*events.Subscription, error) {
+	return r.bus.Subscribe(epoch, after, buffer)
+}
+
+// publish reports a change of filename along with its current metadata.
+func (r *FileRepository) publish(typ events.Type, filename string) {
+	info, err := r.storage.Stat(filename)
+	if err != nil {
+		info = domain.File{Filename: filename}
+	}
+	r.emit(typ, info)
+}
+
+// emit reports a change of the file described by info and updates the
+// search index.
+func (r *FileRepository) emit(typ events.Type, info domain.File) {
+	r.reindex(info.Filename)
+	info.Bucket = r.bucket
+	r.bus.Publish(typ, info)
+}
+
+func (r *FileRepository) HealthCheck(ctx context.Context) error {
+	return r.storage.HealthCheck(ctx)
+}
+
+func (r *FileRepository) ShareSecret() ([]byte, error) {
+	return r.metadata.ShareSecret()
+}
+
+func (r *FileRepository) SaveShareLink(link domain.ShareLink) error {
+	return r.metadata.PutShareLink(link)
+}
+
+func (r *FileRepository) RevokeShareLink(id string) error {
+	return r.metadata.RevokeShareLink(id)
+}
+
+func (r *FileRepository) UseShareLink(id string, now time.Time) (domain.ShareLink, error) {
+	return r.metadata.UseShareLink(id, now)
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"strings"
+
+	"tagesTest/internal/domain"
+	"tagesTest/internal/events"
+)
+
+func (r *FileRepository) CreateFolder(folder string) error {
+	return r.storage.CreateFolder(folder)
+}
+
+func (r *FileRepository) Folders() ([]string, error) {
+	return r.storage.Folders()
+}
+
+// FilesIn returns the files in folder and its subfolders.
+func (r *FileRepository) FilesIn(folder string) ([]domain.File, error) {
+	files, err := r.storage.List()
+	if err != nil {
+		return nil, err
+	}
+	var inside []domain.File
+	for _, file := range files {
+		if strings.HasPrefix(file.Filename, folder+"/") {
+			inside = append(inside, file)
+		}
+	}
+	return inside, nil
+}
+
+// MoveFolder moves folder from with everything in it to to and returns how
+// many files were moved. Both folders are locked for the move, and with an
+// owner every file in from must belong to it.
+func (r *FileRepository) MoveFolder(from, to, owner string) (int, error) {
+	unlock := r.locks.lockFolders(from, to)
+	defer unlock()
+
+	files, err := r.FilesIn(from)
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		if err := r.checkOwner(file.Filename, owner); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := r.storage.MoveFolder(from, to); err != nil {
+		return 0, err
+	}
+	if err := r.metadata.RenameFolder(from, to); err != nil {
+		return len(files), err
+	}
+	for _, file := range files {
+		r.emit(events.Deleted, file)
+		r.publish(events.Created, to+strings.TrimPrefix(file.Filename, from))
+	}
+	return len(files), nil
+}
+
+func (r *FileRepository) DeleteFolder(folder string) error {
+	return r.storage.DeleteFolder(folder)
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"tagesTest/internal/domain"
+	"tagesTest/internal/events"
+	"tagesTest/internal/storage"
+)
+
+// ErrNoColdTier means the storage backend cannot move files to a cold tier.
+var ErrNoColdTier = errors.New("storage has no cold tier")
+
+// ExpiredFiles returns the names of files whose TTL ran out by now.
+func (r *FileRepository) ExpiredFiles(now time.Time) []string {
+	return r.metadata.ExpiredFiles(now)
+}
+
+// ExpireFile removes filename if its TTL ran out by now or, with a positive
+// maxAge, if it was last written more than maxAge before now. The check is
+// repeated under the file's lock, so a file rewritten meanwhile survives.
+func (r *FileRepository) ExpireFile(filename string, now time.Time, maxAge time.Duration) (bool, error) {
+	unlock := r.locks.lock(filename)
+	defer unlock()
+
+	info, err := r.storage.Stat(filename)
+	if err != nil {
+		return false, err
+	}
+	expired := false
+	if expiresAt, ok := r.metadata.Expiry(filename); ok && !expiresAt.After(now) {
+		expired = true
+	}
+	if maxAge > 0 && r.writtenAt(filename, info).Add(maxAge).Before(now) {
+		expired = true
+	}
+	if !expired {
+		return false, nil
+	}
+
+	if err := r.storage.Delete(filename); err != nil {
+		return false, err
+	}
+	r.emit(events.Expired, info)
+	return true, r.metadata.DeleteFile(filename)
+}
+
+// MoveToCold moves filename to the cold tier if it was last written more
+// than minAge before now and is not there yet. Older versions of the file
+// are dropped.
+func (r *FileRepository) MoveToCold(filename string, now time.Time, minAge time.Duration) (bool, error) {
+	mover, ok := r.storage.(storage.ColdMover)
+	if !ok {
+		return false, ErrNoColdTier
+	}
+
+	unlock := r.locks.lock(filename)
+	defer unlock()
+
+	info, err := r.storage.Stat(filename)
+	if err != nil {
+		return false, err
+	}
+	if info.Cold || !r.writtenAt(filename, info).Add(minAge).Before(now) {
+		return false, nil
+	}
+
+	if err := mover.MoveToCold(filename); err != nil {
+		return false, err
+	}
+	if versions, ok := r.metadata.Versions(filename); ok && len(versions) > 1 {
+		var older []int64
+		for _, v := range versions[1:] {
+			older = append(older, v.Version)
+		}
+		if err := r.metadata.RemoveVersions(filename, older); err != nil {
+			return true, err
+		}
+	}
+	r.publish(events.MovedToCold, filename)
+	return true, nil
+}
+
+// writtenAt returns when the current content of a file was written. Moving
+// a file between tiers changes its modification time, so the recorded
+// version time is preferred.
+func (r *FileRepository) writtenAt(filename string, info domain.File) time.Time {
+	if current, ok := r.metadata.CurrentVersion(filename); ok {
+		return current.CreatedAt
+	}
+	return info.UpdatedAt
+}
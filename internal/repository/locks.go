@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// fileLocks serializes changes to the same file while letting changes to
+// different files run in parallel. A locked folder holds off every file
+// under it.
+type fileLocks struct {
+	mu      sync.Mutex
+	freed   *sync.Cond
+	locks   map[string]*fileLock
+	folders map[string]bool
+}
+
+type fileLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// wait blocks until something is unlocked. l.mu must be held.
+func (l *fileLocks) wait() {
+	if l.freed == nil {
+		l.freed = sync.NewCond(&l.mu)
+	}
+	l.freed.Wait()
+}
+
+// broadcast wakes the callers blocked in wait. l.mu must be held.
+func (l *fileLocks) broadcast() {
+	if l.freed != nil {
+		l.freed.Broadcast()
+	}
+}
+
+func (l *fileLocks) lock(filename string) func() {
+	l.mu.Lock()
+	for l.folderLocked(filename) {
+		l.wait()
+	}
+	if l.locks == nil {
+		l.locks = make(map[string]*fileLock)
+	}
+	fl, ok := l.locks[filename]
+	if !ok {
+		fl = &fileLock{}
+		l.locks[filename] = fl
+	}
+	fl.refs++
+	l.mu.Unlock()
+
+	fl.mu.Lock()
+	return func() {
+		fl.mu.Unlock()
+		l.mu.Lock()
+		fl.refs--
+		if fl.refs == 0 {
+			delete(l.locks, filename)
+			l.broadcast()
+		}
+		l.mu.Unlock()
+	}
+}
+
+// lockAll locks the given files in name order, so that callers locking
+// several files at once cannot deadlock.
+func (l *fileLocks) lockAll(filenames ...string) func() {
+	filenames = slices.Compact(slices.Sorted(slices.Values(filenames)))
+	unlocks := make([]func(), 0, len(filenames))
+	for _, filename := range filenames {
+		unlocks = append(unlocks, l.lock(filename))
+	}
+	return func() {
+		for _, unlock := range slices.Backward(unlocks) {
+			unlock()
+		}
+	}
+}
+
+// lockFolders locks the given folders with everything under them. It waits
+// for the files under them that are locked or waited for to be unlocked,
+// and files under them cannot be locked until the folders are unlocked.
+func (l *fileLocks) lockFolders(folders ...string) func() {
+	l.mu.Lock()
+	for l.busy(folders) {
+		l.wait()
+	}
+	if l.folders == nil {
+		l.folders = make(map[string]bool)
+	}
+	for _, folder := range folders {
+		l.folders[folder] = true
+	}
+	l.mu.Unlock()
+
+	return func() {
+		l.mu.Lock()
+		for _, folder := range folders {
+			delete(l.folders, folder)
+		}
+		l.broadcast()
+		l.mu.Unlock()
+	}
+}
+
+// folderLocked reports whether filename is under a locked folder. l.mu must
+// be held.
+func (l *fileLocks) folderLocked(filename string) bool {
+	for folder := range l.folders {
+		if inFolder(filename, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// busy reports whether any of folders overlaps a locked folder or holds a
+// locked file. l.mu must be held.
+func (l *fileLocks) busy(folders []string) bool {
+	for _, folder := range folders {
+		for locked := range l.folders {
+			if locked == folder || inFolder(locked, folder) || inFolder(folder, locked) {
+				return true
+			}
+		}
+		for filename := range l.locks {
+			if inFolder(filename, folder) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inFolder reports whether name lies under folder.
+func inFolder(name, folder string) bool {
+	return strings.HasPrefix(name, folder+"/")
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"io"
+	"sync"
+
+	"tagesTest/internal/domain"
+	"tagesTest/internal/metadata"
+)
+
+// quotaTracker checks writes against the quotas of the whole server. It
+// is shared by the repositories of all buckets: usage is summed over their
+// stores, and the bytes and files of writes still in progress in any of
+// them are counted, so that concurrent uploads cannot overshoot a quota
+// together.
+type quotaTracker struct {
+	mu     sync.Mutex
+	stores map[*metadata.Store]*domain.Usage
+	owners map[string]*domain.Usage
+	total  domain.Usage
+}
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{
+		stores: make(map[*metadata.Store]*domain.Usage),
+		owners: make(map[string]*domain.Usage),
+	}
+}
+
+// add counts the usage of store from now on.
+func (t *quotaTracker) add(store *metadata.Store) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stores[store] = &domain.Usage{}
+}
+
+// remove stops counting the usage of store.
+func (t *quotaTracker) remove(store *metadata.Store) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.stores, store)
+}
+
+// usage returns what owner holds in all stores. The caller holds t.mu.
+func (t *quotaTracker) usage(owner string) domain.Usage {
+	var usage domain.Usage
+	for store := range t.stores {
+		u := store.Usage(owner)
+		usage.Bytes += u.Bytes
+		usage.Files += u.Files
+	}
+	return usage
+}
+
+// totalUsage returns what all owners hold in all stores. The caller holds
+// t.mu.
+func (t *quotaTracker) totalUsage() domain.Usage {
+	var total domain.Usage
+	for store := range t.stores {
+		u := store.TotalUsage()
+		total.Bytes += u.Bytes
+		total.Files += u.Files
+	}
+	return total
+}
+
+// reserved returns the reservations of owner, creating them if needed. The
+// caller holds t.mu.
+func (t *quotaTracker) reserved(owner string) *domain.Usage {
+	reserved, ok := t.owners[owner]
+	if !ok {
+		reserved = &domain.Usage{}
+		t.owners[owner] = reserved
+	}
+	return reserved
+}
+
+// bucket returns the reservations in store. A store removed meanwhile gets
+// ones that are thrown away. The caller holds t.mu.
+func (t *quotaTracker) bucket(store *metadata.Store) *domain.Usage {
+	if reserved, ok := t.stores[store]; ok {
+		return reserved
+	}
+	return &domain.Usage{}
+}
+
+// reserveFile makes room for one more file of owner in store.
+func (t *quotaTracker) reserveFile(store *metadata.Store, owner string, quotas domain.Quotas) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	owned, bucket := t.reserved(owner), t.bucket(store)
+	usage, total, bucketUsage := t.usage(owner), t.totalUsage(), store.TotalUsage()
+	if exceeds(usage.Files+owned.Files+1, quotas.Owner.MaxFiles) ||
+		exceeds(total.Files+t.total.Files+1, quotas.Global.MaxFiles) ||
+		exceeds(bucketUsage.Files+bucket.Files+1, quotas.Bucket.MaxFiles) {
+		t.prune(owner)
+		return domain.ErrQuotaExceeded
+	}
+	owned.Files++
+	t.total.Files++
+	bucket.Files++
+	return nil
+}
+
+func (t *quotaTracker) releaseFile(store *metadata.Store, owner string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reserved(owner).Files--
+	t.prune(owner)
+	t.total.Files--
+	if bucket, ok := t.stores[store]; ok {
+		bucket.Files--
+	}
+}
+
+// reserveBytes makes room for n more bytes of owner in store. credit is
+// what the write frees once it replaces the current content.
+func (t *quotaTracker) reserveBytes(store *metadata.Store, owner string, n, credit int64, quotas domain.Quotas) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	owned, bucket := t.reserved(owner), t.bucket(store)
+	usage, total, bucketUsage := t.usage(owner), t.totalUsage(), store.TotalUsage()
+	if exceeds(usage.Bytes+owned.Bytes+n-credit, quotas.Owner.MaxBytes) ||
+		exceeds(total.Bytes+t.total.Bytes+n-credit, quotas.Global.MaxBytes) ||
+		exceeds(bucketUsage.Bytes+bucket.Bytes+n-credit, quotas.Bucket.MaxBytes) {
+		t.prune(owner)
+		return domain.ErrQuotaExceeded
+	}
+	owned.Bytes += n
+	t.total.Bytes += n
+	bucket.Bytes += n
+	return nil
+}
+
+func (t *quotaTracker) releaseBytes(store *metadata.Store, owner string, n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reserved(owner).Bytes -= n
+	t.prune(owner)
+	t.total.Bytes -= n
+	if bucket, ok := t.stores[store]; ok {
+		bucket.Bytes -= n
+	}
+}
+
+// prune forgets the reservations of owner once none is left. The caller
+// holds t.mu.
+func (t *quotaTracker) prune(owner string) {
+	if reserved, ok := t.owners[owner]; ok && *reserved == (domain.Usage{}) {
+		delete(t.owners, owner)
+	}
+}
+
+func exceeds(value, limit int64) bool {
+	return limit > 0 && value > limit
+}
+
+// quotaReader fails with domain.ErrQuotaExceeded as soon as the bytes read
+// would take the owner, the bucket or the whole server over its quota.
+type quotaReader struct {
+	src      io.Reader
+	tracker  *quotaTracker
+	store    *metadata.Store
+	owner    string
+	credit   int64
+	quotas   domain.Quotas
+	reserved int64
+}
+
+func (r *quotaReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if n > 0 {
+		if err := r.tracker.reserveBytes(r.store, r.owner, int64(n), r.credit, r.quotas); err != nil {
+			return 0, err
+		}
+		r.reserved += int64(n)
+	}
+	return n, err
+}
+
+// release gives back the reservation once the write is recorded or failed.
+func (r *quotaReader) release() {
+	r.tracker.releaseBytes(r.store, r.owner, r.reserved)
+}
+
+// Usage returns what owner holds in all buckets.
+func (r *FileRepository) Usage(owner string) domain.Usage {
+	r.quota.mu.Lock()
+	defer r.quota.mu.Unlock()
+	return r.quota.usage(owner)
+}
+
+// TotalUsage returns what all owners hold in all buckets together.
+func (r *FileRepository) TotalUsage() domain.Usage {
+	r.quota.mu.Lock()
+	defer r.quota.mu.Unlock()
+	return r.quota.totalUsage()
+}
+
+// BucketUsage returns what all owners hold in the bucket of r.
+func (r *FileRepository) BucketUsage() domain.Usage {
+	return r.metadata.TotalUsage()
+}
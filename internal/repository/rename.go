@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"tagesTest/internal/domain"
+	"tagesTest/internal/events"
+)
+
+// RenameFile moves from to to along with its versions, owner and expiry and
+// returns its current version. An existing to is replaced as opts.Mode
+// allows, losing its own versions; it is kept until from is in its place.
+// When opts.Owner is set, from and an existing to must belong to it.
+func (r *FileRepository) RenameFile(from, to string, opts domain.WriteOptions) (domain.FileVersion, error) {
+	if from == to {
+		return domain.FileVersion{}, domain.ErrInvalidFilename
+	}
+	unlock := r.locks.lockAll(from, to)
+	defer unlock()
+
+	current, err := r.currentVersion(from)
+	if err != nil {
+		return domain.FileVersion{}, err
+	}
+	if err := r.checkOwner(from, opts.Owner); err != nil {
+		return domain.FileVersion{}, err
+	}
+	info, err := r.storage.Stat(from)
+	if err != nil {
+		return domain.FileVersion{}, err
+	}
+	if _, _, err := r.checkTarget(to, opts); err != nil {
+		return domain.FileVersion{}, err
+	}
+	staged, err := r.stageTarget(to)
+	if err != nil {
+		return domain.FileVersion{}, err
+	}
+	if err := r.storage.Rename(from, to); err != nil {
+		return domain.FileVersion{}, r.unstageTarget(to, staged, err)
+	}
+	r.dropTarget(staged)
+	replaced := staged != ""
+	if err := r.metadata.RenameFile(from, to); err != nil {
+		return current, err
+	}
+	r.emit(events.Deleted, info)
+	r.publish(targetEvent(replaced), to)
+	return current, nil
+}
+
+// CopyFile stores the current content of from under to as version 1 of a
+// new file of opts.Owner, keeping the checksum and expiry of from. An
+// existing to is replaced as opts.Mode allows; it is kept until the copy is
+// in its place. When opts.Owner is set, from and an existing to must belong
+// to it.
+func (r *FileRepository) CopyFile(from, to string, opts domain.WriteOptions) (domain.FileVersion, error) {
+	if from == to {
+		return domain.FileVersion{}, domain.ErrInvalidFilename
+	}
+	unlock := r.locks.lockAll(from, to)
+	defer unlock()
+
+	source, err := r.currentVersion(from)
+	if err != nil {
+		return domain.FileVersion{}, err
+	}
+	if err := r.checkOwner(from, opts.Owner); err != nil {
+		return domain.FileVersion{}, err
+	}
+	exists, credit, err := r.checkTarget(to, opts)
+	if err != nil {
+		return domain.FileVersion{}, err
+	}
+	// replacing a file does not add one and frees what it held
+	if !exists {
+		if err := r.quota.reserveFile(r.metadata, opts.Owner, opts.Quotas); err != nil {
+			return domain.FileVersion{}, err
+		}
+		defer r.quota.releaseFile(r.metadata, opts.Owner)
+	}
+	if err := r.quota.reserveBytes(r.metadata, opts.Owner, source.Size, credit, opts.Quotas); err != nil {
+		return domain.FileVersion{}, err
+	}
+	defer r.quota.releaseBytes(r.metadata, opts.Owner, source.Size)
+
+	staged, err := r.stageTarget(to)
+	if err != nil {
+		return domain.FileVersion{}, err
+	}
+	n, err := r.storage.Copy(from, to)
+	if err != nil {
+		return domain.FileVersion{}, r.unstageTarget(to, staged, err)
+	}
+	r.dropTarget(staged)
+	replaced := staged != ""
+	version := domain.FileVersion{
+		Version:   1,
+		Size:      n,
+		Checksum:  source.Checksum,
+		CreatedAt: time.Now(),
+		Width:     source.Width,
+		Height:    source.Height,
+	}
+	if err := r.metadata.CopyFile(from, to, version, opts.Owner); err != nil {
+		return version, err
+	}
+	r.publish(targetEvent(replaced), to)
+	return version, nil
+}
+
+// checkOwner fails with domain.ErrNotOwner if filename belongs to someone
+// other than owner. Files without a recorded owner belong to everyone.
+func (r *FileRepository) checkOwner(filename, owner string) error {
+	if owner == "" {
+		return nil
+	}
+	if recorded, ok := r.metadata.Owner(filename); ok && recorded != owner {
+		return domain.ErrNotOwner
+	}
+	return nil
+}
+
+// checkTarget checks that opts.Mode allows to to be written and that an
+// existing to belongs to opts.Owner. It reports whether to exists and the
+// bytes its versions hold, which replacing it frees.
+func (r *FileRepository) checkTarget(to string, opts domain.WriteOptions) (bool, int64, error) {
+	current, err := r.currentVersion(to)
+	if errors.Is(err, domain.ErrFileNotFound) {
+		if opts.Mode == domain.WriteOverwriteIfMatch {
+			return false, 0, domain.ErrPreconditionFailed
+		}
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	switch opts.Mode {
+	case domain.WriteCreateOnly:
+		return false, 0, domain.ErrFileExists
+	case domain.WriteOverwriteIfMatch:
+		if err := r.checkMatch(to, current, opts); err != nil {
+			return false, 0, err
+		}
+	}
+	if err := r.checkOwner(to, opts.Owner); err != nil {
+		return false, 0, err
+	}
+	var size int64
+	versions, _ := r.metadata.Versions(to)
+	for _, v := range versions {
+		size += v.Size
+	}
+	return true, size, nil
+}
+
+// stageTarget moves an existing to aside, into the trash of the storage
+// under an id no trash entry has, so that a failed rename or copy can bring
+// it back. It returns the id, or an empty one if to does not exist.
+func (r *FileRepository) stageTarget(to string) (string, error) {
+	if _, err := r.storage.Stat(to); errors.Is(err, domain.ErrFileNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	staged := "replaced-" + hex.EncodeToString(id)
+	if err := r.storage.Trash(to, staged); err != nil {
+		return "", err
+	}
+	return staged, nil
+}
+
+// unstageTarget brings a staged to back after cause made the rename or copy
+// fail, and returns cause along with any error of doing so.
+func (r *FileRepository) unstageTarget(to, staged string, cause error) error {
+	if staged == "" {
+		return cause
+	}
+	return errors.Join(cause, r.storage.Restore(staged, to))
+}
+
+// dropTarget removes a staged to once it has been replaced.
+func (r *FileRepository) dropTarget(staged string) {
+	if staged != "" {
+		// a leftover only takes space, the replacement is in place already
+		_ = r.storage.PurgeTrash(staged)
+	}
+}
+
+func targetEvent(replaced bool) events.Type {
+	if replaced {
+		return events.Updated
+	}
+	return events.Created
+}
@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"cmp"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"tagesTest/internal/domain"
+)
+
+// searchIndex keeps what searches look at for every file, along with
+// postings of name trigrams and tags that narrow a search down before the
+// remaining filters are checked file by file. It is built on the first
+// search and kept in step by emit afterwards.
+type searchIndex struct {
+	mu    sync.Mutex
+	built bool
+	docs  map[string]indexedFile
+	grams map[string]map[string]struct{}
+	tags  map[string]map[string]struct{}
+}
+
+type indexedFile struct {
+	file    domain.File
+	version domain.FileVersion
+	// lower is the lowercased path that names are matched against
+	lower string
+}
+
+// Search returns the page of files matching q selected by q.Offset and
+// q.Limit, best first, and how many match in total.
+func (r *FileRepository) Search(q domain.SearchQuery) ([]domain.SearchResult, int, error) {
+	r.index.mu.Lock()
+	defer r.index.mu.Unlock()
+
+	if !r.index.built {
+		if err := r.buildIndex(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	name := strings.ToLower(q.Name)
+	var results []domain.SearchResult
+	for _, filename := range r.index.candidates(name, q) {
+		doc := r.index.docs[filename]
+		if !doc.matches(q) {
+			continue
+		}
+		score := 1.0
+		if name != "" {
+			if score = nameScore(doc.lower, name, q.Fuzzy); score == 0 {
+				continue
+			}
+		}
+		results = append(results, domain.SearchResult{File: doc.file, Version: doc.version, Score: score})
+	}
+	slices.SortFunc(results, func(a, b domain.SearchResult) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.File.Filename, b.File.Filename)
+	})
+
+	total := len(results)
+	start := min(q.Offset, total)
+	end := total
+	if q.Limit > 0 {
+		end = min(start+q.Limit, total)
+	}
+	return results[start:end], total, nil
+}
+
+// buildIndex indexes every stored file. The caller holds r.index.mu.
+func (r *FileRepository) buildIndex() error {
+	files, err := r.storage.List()
+	if err != nil {
+		return err
+	}
+	r.index.docs = make(map[string]indexedFile, len(files))
+	r.index.grams = make(map[string]map[string]struct{})
+	r.index.tags = make(map[string]map[string]struct{})
+	for _, file := range files {
+		r.indexFile(file)
+	}
+	r.index.built = true
+	return nil
+}
+
+// reindex brings the entry of filename in line with the storage after a
+// change, once the index is built.
+func (r *FileRepository) reindex(filename string) {
+	r.index.mu.Lock()
+	defer r.index.mu.Unlock()
+
+	if !r.index.built {
+		return
+	}
+	r.index.remove(filename)
+	file, err := r.storage.Stat(filename)
+	if errors.Is(err, domain.ErrFileNotFound) {
+		return
+	}
+	if err != nil {
+		// the next search rebuilds the index from scratch
+		r.index.built = false
+		return
+	}
+	r.indexFile(file)
+}
+
+// indexFile adds file with its attributes and current version. The caller
+// holds r.index.mu.
+func (r *FileRepository) indexFile(file domain.File) {
+	file.Attributes = r.metadata.Attributes(file.Filename)
+	version, _ := r.metadata.CurrentVersion(file.Filename)
+	doc := indexedFile{file: file, version: version, lower: strings.ToLower(file.Filename)}
+	r.index.docs[file.Filename] = doc
+	for _, gram := range trigrams(doc.lower) {
+		addPosting(r.index.grams, gram, file.Filename)
+	}
+	for _, tag := range file.Attributes.Tags {
+		addPosting(r.index.tags, tag, file.Filename)
+	}
+}
+
+func (i *searchIndex) remove(filename string) {
+	doc, ok := i.docs[filename]
+	if !ok {
+		return
+	}
+	delete(i.docs, filename)
+	for _, gram := range trigrams(doc.lower) {
+		removePosting(i.grams, gram, filename)
+	}
+	for _, tag := range doc.file.Attributes.Tags {
+		removePosting(i.tags, tag, filename)
+	}
+}
+
+// candidates returns the files that may match q: those having all of its
+// tags and, unless the search is fuzzy, every trigram of name.
+func (i *searchIndex) candidates(name string, q domain.SearchQuery) []string {
+	var keys []map[string]struct{}
+	for _, tag := range q.Tags {
+		keys = append(keys, i.tags[tag])
+	}
+	if !q.Fuzzy {
+		for _, gram := range trigrams(name) {
+			keys = append(keys, i.grams[gram])
+		}
+	}
+	if len(keys) == 0 {
+		all := make([]string, 0, len(i.docs))
+		for filename := range i.docs {
+			all = append(all, filename)
+		}
+		return all
+	}
+
+	// walk the shortest posting list and check the others
+	slices.SortFunc(keys, func(a, b map[string]struct{}) int {
+		return cmp.Compare(len(a), len(b))
+	})
+	var found []string
+	for filename := range keys[0] {
+		inAll := true
+		for _, postings := range keys[1:] {
+			if _, ok := postings[filename]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			found = append(found, filename)
+		}
+	}
+	return found
+}
+
+// matches checks every filter of q but the name.
+func (d indexedFile) matches(q domain.SearchQuery) bool {
+	file, attributes := d.file, d.file.Attributes
+	if !strings.HasPrefix(file.Filename, q.Prefix) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if _, ok := slices.BinarySearch(attributes.Tags, tag); !ok {
+			return false
+		}
+	}
+	for key, value := range q.Metadata {
+		got, ok := attributes.Metadata[key]
+		if !ok || value != "" && got != value {
+			return false
+		}
+	}
+	if q.MinSize > 0 && file.Size < q.MinSize || q.MaxSize > 0 && file.Size > q.MaxSize {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && file.CreatedAt.Before(q.CreatedAfter) ||
+		!q.CreatedBefore.IsZero() && !file.CreatedAt.Before(q.CreatedBefore) {
+		return false
+	}
+	if !q.UpdatedAfter.IsZero() && file.UpdatedAt.Before(q.UpdatedAfter) ||
+		!q.UpdatedBefore.IsZero() && !file.UpdatedAt.Before(q.UpdatedBefore) {
+		return false
+	}
+	if q.MinWidth > 0 || q.MaxWidth > 0 || q.MinHeight > 0 || q.MaxHeight > 0 {
+		width, height := d.version.Width, d.version.Height
+		if width == 0 || height == 0 ||
+			width < q.MinWidth || q.MaxWidth > 0 && width > q.MaxWidth ||
+			height < q.MinHeight || q.MaxHeight > 0 && height > q.MaxHeight {
+			return false
+		}
+	}
+	return true
+}
+
+// nameScore rates how well the lowercased path matches the lowercased
+// name: matches of the whole base name rank above those inside it, which
+// rank above matches elsewhere in the path and above fuzzy ones. Zero means
+// no match.
+func nameScore(lower, name string, fuzzy bool) float64 {
+	base := path.Base(lower)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	switch {
+	case base == name || stem == name:
+		return 1
+	case strings.HasPrefix(base, name):
+		return 0.9
+	case strings.Contains(base, name):
+		return 0.8
+	case strings.Contains(lower, name):
+		return 0.6
+	}
+	if !fuzzy {
+		return 0
+	}
+	query := []rune(name)
+	distance := substringDistance([]rune(base), query)
+	if distance > maxTypos(len(query)) {
+		return 0
+	}
+	return 0.5 * (1 - float64(distance)/float64(len(query)+1))
+}
+
+// maxTypos is how many edits a fuzzy match of a name of n runes allows, a
+// swap of two neighbouring runes counting as two.
+func maxTypos(n int) int {
+	return n / 3
+}
+
+// substringDistance returns the fewest edits turning query into some
+// substring of text.
+func substringDistance(text, query []rune) int {
+	prev := make([]int, len(text)+1)
+	cur := make([]int, len(text)+1)
+	for i := 1; i <= len(query); i++ {
+		cur[0] = i
+		for j := 1; j <= len(text); j++ {
+			cost := 1
+			if query[i-1] == text[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j-1]+cost, prev[j]+1, cur[j-1]+1)
+		}
+		prev, cur = cur, prev
+	}
+	return slices.Min(prev)
+}
+
+// trigrams returns the distinct three-rune substrings of s.
+func trigrams(s string) []string {
+	runes := []rune(s)
+	var grams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+3]))
+	}
+	return slices.Compact(slices.Sorted(slices.Values(grams)))
+}
+
+func addPosting(postings map[string]map[string]struct{}, key, filename string) {
+	set, ok := postings[key]
+	if !ok {
+		set = make(map[string]struct{})
+		postings[key] = set
+	}
+	set[filename] = struct{}{}
+}
+
+func removePosting(postings map[string]map[string]struct{}, key, filename string) {
+	delete(postings[key], filename)
+	if len(postings[key]) == 0 {
+		delete(postings, key)
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"tagesTest/internal/domain"
+	"tagesTest/internal/events"
+)
+
+// TrashFile moves entry.Filename into the trash as entry, filling in its size.
+func (r *FileRepository) TrashFile(entry domain.TrashEntry) (domain.TrashEntry, error) {
+	unlock := r.locks.lock(entry.Filename)
+	defer unlock()
+
+	info, err := r.storage.Stat(entry.Filename)
+	if err != nil {
+		return entry, err
+	}
+	entry.Size = info.Size
+	if err := r.storage.Trash(entry.Filename, entry.ID); err != nil {
+		return entry, err
+	}
+	r.emit(events.Deleted, info)
+	return entry, r.metadata.TrashFile(entry)
+}
+
+func (r *FileRepository) ListTrash() []domain.TrashEntry {
+	return r.metadata.TrashEntries()
+}
+
+// RestoreFile moves trash entry id back under its original name.
+func (r *FileRepository) RestoreFile(id string) (domain.TrashEntry, error) {
+	entry, err := r.metadata.TrashEntry(id)
+	if err != nil {
+		return entry, err
+	}
+
+	unlock := r.locks.lock(entry.Filename)
+	defer unlock()
+
+	// restored or purged while waiting for the lock
+	if _, err := r.metadata.TrashEntry(id); err != nil {
+		return entry, err
+	}
+	if err := r.storage.Restore(id, entry.Filename); err != nil {
+		return entry, err
+	}
+	if err := r.metadata.RestoreTrash(id); err != nil {
+		return entry, err
+	}
+	r.publish(events.Created, entry.Filename)
+	return entry, nil
+}
+
+// PurgeTrash permanently removes trash entry id. The entry's file name is
+// locked as in RestoreFile, so a purge and a restore of the same entry do
+// not interleave.
+func (r *FileRepository) PurgeTrash(id string) error {
+	entry, err := r.metadata.TrashEntry(id)
+	if err != nil {
+		return err
+	}
+
+	unlock := r.locks.lock(entry.Filename)
+	defer unlock()
+
+	// restored or purged while waiting for the lock
+	if _, err := r.metadata.TrashEntry(id); err != nil {
+		return err
+	}
+	err = r.storage.PurgeTrash(id)
+	if err != nil && !errors.Is(err, domain.ErrTrashEntryNotFound) {
+		return err
+	}
+	return r.metadata.DeleteTrash(id)
+}
+
+// ExpiredTrash returns the IDs of trash entries past their retention.
+func (r *FileRepository) ExpiredTrash(now time.Time) []string {
+	return r.metadata.ExpiredTrash(now)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"tagesTest/internal/archive"
+	"tagesTest/internal/domain"
+)
+
+// ArchiveRequest selects the files of an archive by name, by prefix or both.
+type ArchiveRequest struct {
+	Filenames []string
+	Prefix    string
+	Format    archive.Format
+	// Accept filters requested files, rejected ones are reported as missing.
+	Accept func(filename string) bool
+}
+
+// ArchiveManifest is written into every archive as archive.ManifestName.
+type ArchiveManifest struct {
+	Files   []string       `json:"files"`
+	Missing []MissingEntry `json:"missing"`
+}
+
+type MissingEntry struct {
+	Filename string `json:"filename"`
+	Reason   string `json:"reason"`
+}
+
+// WriteArchive streams the requested files as an archive into w, reading
+// them from storage one by one. Files that cannot be added are listed in the
+// manifest instead of failing the whole archive.
+func (s *FileService) WriteArchive(ctx context.Context, w io.Writer, req ArchiveRequest) (ArchiveManifest, error) {
+	manifest := ArchiveManifest{Files: []string{}, Missing: []MissingEntry{}}
+	names, err := s.archiveNames(req)
+	if err != nil {
+		return manifest, err
+	}
+
+	aw := archive.NewWriter(req.Format, w)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return manifest, err
+		}
+		if req.Accept != nil && !req.Accept(name) {
+			manifest.Missing = append(manifest.Missing, MissingEntry{Filename: name, Reason: "not an image"})
+			continue
+		}
+		err := s.addToArchive(aw, name)
+		if errors.Is(err, domain.ErrFileNotFound) || errors.Is(err, domain.ErrInvalidFilename) {
+			manifest.Missing = append(manifest.Missing, MissingEntry{Filename: name, Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			// the archive is broken at this point, there is nothing to report it in
+			return manifest, err
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	if err := aw.Add(archive.ManifestName, int64(len(data)), time.Now(), bytes.NewReader(data)); err != nil {
+		return manifest, err
+	}
+	return manifest, aw.Close()
+}
+
+// archiveNames resolves the request into a sorted list of unique names.
+func (s *FileService) archiveNames(req ArchiveRequest) ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range req.Filenames {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if req.Prefix != "" {
+		files, err := s.repo.ListFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if strings.HasPrefix(file.Filename, req.Prefix) && !seen[file.Filename] {
+				seen[file.Filename] = true
+				names = append(names, file.Filename)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *FileService) addToArchive(aw archive.Writer, name string) error {
+	info, err := s.repo.StatFile(name)
+	if err != nil {
+		return err
+	}
+	file, err := s.repo.GetFile(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return aw.Add(name, info.Size, info.UpdatedAt, file)
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"tagesTest/internal/domain"
+	"tagesTest/internal/repository"
+)
+
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// Buckets keeps a FileService for the default bucket and one for every
+// created bucket. The buckets themselves are recorded by the default one.
+type Buckets struct {
+	mu       sync.RWMutex
+	main     *FileService
+	layout   *repository.BucketLayout
+	services map[string]*FileService
+}
+
+// NewBuckets opens every recorded bucket through layout.
+func NewBuckets(main *FileService, layout *repository.BucketLayout) (*Buckets, error) {
+	b := &Buckets{main: main, layout: layout, services: make(map[string]*FileService)}
+	for _, bucket := range main.repo.ListBuckets() {
+		repo, err := layout.Open(bucket.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open bucket %s: %w", bucket.Name, err)
+		}
+		b.services[bucket.Name] = &FileService{repo: repo, signer: main.signer, bucket: bucket}
+	}
+	return b, nil
+}
+
+// Default returns the service of the default bucket.
+func (b *Buckets) Default() *FileService {
+	return b.main
+}
+
+// Get returns the service of the named bucket, or of the default one if name
+// is empty.
+func (b *Buckets) Get(name string) (*FileService, error) {
+	if name == "" {
+		return b.main, nil
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	service, ok := b.services[name]
+	if !ok {
+		return nil, domain.ErrBucketNotFound
+	}
+	return service, nil
+}
+
+// All returns the services of the default bucket and of every other one.
+func (b *Buckets) All() []*FileService {
+	services := []*FileService{b.main}
+	for _, bucket := range b.List() {
+		if service, err := b.Get(bucket.Name); err == nil {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+// OpenShareLink opens the file token was issued for in the bucket of the
+// link.
+func (b *Buckets) OpenShareLink(token string) (domain.ShareLink, io.ReadCloser, error) {
+	claimed, err := b.main.signer.Verify(token, time.Now())
+	if err != nil {
+		return domain.ShareLink{}, nil, err
+	}
+	service, err := b.Get(claimed.Bucket)
+	if err != nil {
+		// the bucket was deleted together with its links
+		return domain.ShareLink{}, nil, domain.ErrShareLinkInvalid
+	}
+	return service.OpenShareLink(token)
+}
+
+func (b *Buckets) List() []domain.Bucket {
+	return b.main.repo.ListBuckets()
+}
+
+// Create records bucket and prepares its storage.
+func (b *Buckets) Create(bucket domain.Bucket) (domain.Bucket, error) {
+	if !bucketName.MatchString(bucket.Name) {
+		return domain.Bucket{}, domain.ErrInvalidBucketName
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.services[bucket.Name]; ok {
+		return domain.Bucket{}, domain.ErrBucketExists
+	}
+	// leftovers of a bucket whose deletion was interrupted must not come back
+	if err := b.layout.Remove(bucket.Name); err != nil {
+		return domain.Bucket{}, err
+	}
+	repo, err := b.layout.Open(bucket.Name)
+	if err != nil {
+		return domain.Bucket{}, err
+	}
+	bucket.CreatedAt = time.Now()
+	if err := b.main.repo.CreateBucket(bucket); err != nil {
+		// the bucket was not recorded, so its store goes away again
+		return domain.Bucket{}, errors.Join(err, repo.Close(), b.layout.Remove(bucket.Name))
+	}
+	b.services[bucket.Name] = &FileService{repo: repo, signer: b.main.signer, bucket: bucket}
+	return bucket, nil
+}
+
+// Delete removes the named bucket. Unless force is set, a bucket that still
+// holds files, in its trash included, fails with domain.ErrBucketNotEmpty.
+func (b *Buckets) Delete(name string, force bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	service, ok := b.services[name]
+	if !ok {
+		return domain.ErrBucketNotFound
+	}
+	if !force {
+		files, err := service.ListFiles()
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 || len(service.ListTrash()) > 0 {
+			return domain.ErrBucketNotEmpty
+		}
+	}
+	if err := b.main.repo.DeleteBucket(name); err != nil {
+		return err
+	}
+	delete(b.services, name)
+	if err := service.repo.Close(); err != nil {
+		return err
+	}
+	return b.layout.Remove(name)
+}
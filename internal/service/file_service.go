@@ -1,21 +1,104 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"io"
 	"tagesTest/internal/domain"
+	"tagesTest/internal/events"
 	"tagesTest/internal/repository"
+	"tagesTest/internal/sharelink"
+	"time"
 )
 
 type FileService struct {
-	repo *repository.FileRepository
+	repo   *repository.FileRepository
+	signer *sharelink.Signer
+	bucket domain.Bucket
 }
 
-func NewFileService(repo *repository.FileRepository) *FileService {
-	return &FileService{repo: repo}
+func NewFileService(repo *repository.FileRepository, signer *sharelink.Signer) *FileService {
+	return &FileService{repo: repo, signer: signer}
 }
 
-func (s *FileService) SaveFile(filename string, reader io.Reader) error {
-	return s.repo.SaveFile(filename, reader)
+// Bucket returns the bucket the service works on.
+func (s *FileService) Bucket() domain.Bucket {
+	return s.bucket
+}
+
+// WriteFile stores reader under filename, creating or replacing the file as
+// opts allows.
+func (s *FileService) WriteFile(filename string, reader io.Reader, opts domain.WriteOptions) (domain.FileVersion, error) {
+	attributes := domain.Attributes{Metadata: opts.Metadata, Tags: opts.Tags}
+	if err := attributes.Validate(); err != nil {
+		return domain.FileVersion{}, err
+	}
+	return s.repo.WriteFile(filename, reader, opts)
+}
+
+// UpdateMetadata changes the metadata and tags of filename as update says
+// and returns the result.
+func (s *FileService) UpdateMetadata(filename string, update domain.AttributesUpdate) (domain.Attributes, error) {
+	return s.repo.UpdateAttributes(filename, update)
+}
+
+// RenameFile moves from to to with its versions, replacing an existing to as
+// opts.Mode allows. When opts.Owner is set, from must belong to it.
+func (s *FileService) RenameFile(from, to string, opts domain.WriteOptions) (domain.FileVersion, error) {
+	return s.repo.RenameFile(from, to, opts)
+}
+
+// CopyFile copies the current content of from to to, replacing an existing
+// to as opts.Mode allows. The copy is charged to opts.Owner, who must own
+// from if it has an owner.
+func (s *FileService) CopyFile(from, to string, opts domain.WriteOptions) (domain.FileVersion, error) {
+	return s.repo.CopyFile(from, to, opts)
+}
+
+// Usage returns what owner and all owners together hold in all buckets.
+func (s *FileService) Usage(owner string) (domain.Usage, domain.Usage) {
+	return s.repo.Usage(owner), s.repo.TotalUsage()
+}
+
+// BucketUsage returns what all owners hold in the bucket of s.
+func (s *FileService) BucketUsage() domain.Usage {
+	return s.repo.BucketUsage()
+}
+
+func (s *FileService) ListFileVersions(filename string) ([]domain.FileVersion, error) {
+	return s.repo.ListVersions(filename)
+}
+
+// DownloadFileVersion opens the given version of filename. Version 0 means
+// the latest one.
+func (s *FileService) DownloadFileVersion(filename string, version int64) (io.ReadCloser, error) {
+	if version == 0 {
+		return s.repo.GetFile(filename)
+	}
+	return s.repo.GetFileVersion(filename, version)
+}
+
+// PruneVersions removes older versions beyond retention from filename, or
+// from every file when filename is empty, and returns how many were removed.
+func (s *FileService) PruneVersions(filename string, retention domain.VersionRetention) (int, error) {
+	if filename != "" {
+		if _, err := s.repo.StatFile(filename); err != nil {
+			return 0, err
+		}
+		return s.repo.PruneVersions(filename, retention)
+	}
+
+	total := 0
+	for _, name := range s.repo.VersionedFiles() {
+		n, err := s.repo.PruneVersions(name, retention)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
 }
 
 func (s *FileService) ListFiles() ([]domain.File, error) {
@@ -25,3 +108,132 @@ func (s *FileService) ListFiles() ([]domain.File, error) {
 func (s *FileService) DownloadFile(filename string) (io.ReadCloser, error) {
 	return s.repo.GetFile(filename)
 }
+
+func (s *FileService) StatFile(filename string) (domain.File, error) {
+	return s.repo.StatFile(filename)
+}
+
+// DeleteFile moves filename into the trash for retention, or removes it
+// permanently when retention is zero.
+func (s *FileService) DeleteFile(filename string, retention time.Duration) (domain.TrashEntry, error) {
+	if retention <= 0 {
+		return domain.TrashEntry{}, s.repo.DeleteFile(filename)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return domain.TrashEntry{}, err
+	}
+	now := time.Now()
+	return s.repo.TrashFile(domain.TrashEntry{
+		ID:        hex.EncodeToString(id),
+		Filename:  filename,
+		DeletedAt: now,
+		ExpiresAt: now.Add(retention),
+	})
+}
+
+func (s *FileService) ListTrash() []domain.TrashEntry {
+	return s.repo.ListTrash()
+}
+
+func (s *FileService) RestoreFile(id string) (domain.TrashEntry, error) {
+	return s.repo.RestoreFile(id)
+}
+
+// PurgeTrash permanently removes the given trash entries and returns how many
+// were removed.
+func (s *FileService) PurgeTrash(ids []string) (int, error) {
+	for i, id := range ids {
+		if err := s.repo.PurgeTrash(id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// PurgeExpiredTrash permanently removes trash entries past their retention.
+func (s *FileService) PurgeExpiredTrash(now time.Time) (int, error) {
+	purged := 0
+	for _, id := range s.repo.ExpiredTrash(now) {
+		err := s.repo.PurgeTrash(id)
+		if errors.Is(err, domain.ErrTrashEntryNotFound) {
+			// restored or purged meanwhile
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *FileService) HealthCheck(ctx context.Context) error {
+	return s.repo.HealthCheck(ctx)
+}
+
+// WatchFiles subscribes to file changes after sequence after of epoch.
+func (s *FileService) WatchFiles(epoch string, after uint64, buffer int) (*events.Subscription, error) {
+	return s.repo.Subscribe(epoch, after, buffer)
+}
+
+// CreateShareLink issues a signed token for filename valid until expiresAt.
+// maxDownloads of zero means unlimited.
+func (s *FileService) CreateShareLink(filename string, expiresAt time.Time, maxDownloads int) (domain.ShareLink, string, error) {
+	if _, err := s.repo.StatFile(filename); err != nil {
+		return domain.ShareLink{}, "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return domain.ShareLink{}, "", err
+	}
+	link := domain.ShareLink{
+		ID:           hex.EncodeToString(id),
+		Filename:     filename,
+		Bucket:       s.bucket.Name,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    expiresAt.Truncate(time.Second),
+		MaxDownloads: maxDownloads,
+	}
+	token, err := s.signer.Sign(link)
+	if err != nil {
+		return domain.ShareLink{}, "", err
+	}
+	if err := s.repo.SaveShareLink(link); err != nil {
+		return domain.ShareLink{}, "", err
+	}
+	return link, token, nil
+}
+
+func (s *FileService) RevokeShareLink(id string) error {
+	return s.repo.RevokeShareLink(id)
+}
+
+// OpenShareLink verifies token, counts the download and opens the shared
+// file. Links issued for another bucket are invalid here.
+func (s *FileService) OpenShareLink(token string) (domain.ShareLink, io.ReadCloser, error) {
+	now := time.Now()
+	claimed, err := s.signer.Verify(token, now)
+	if err != nil {
+		return domain.ShareLink{}, nil, err
+	}
+	if claimed.Bucket != s.bucket.Name {
+		return domain.ShareLink{}, nil, domain.ErrShareLinkInvalid
+	}
+
+	file, err := s.repo.GetFile(claimed.Filename)
+	if err != nil {
+		return domain.ShareLink{}, nil, err
+	}
+	link, err := s.repo.UseShareLink(claimed.ID, now)
+	if err == nil && link.Filename != claimed.Filename {
+		err = domain.ErrShareLinkInvalid
+	}
+	if err != nil {
+		file.Close()
+		return domain.ShareLink{}, nil, err
+	}
+	return link, file, nil
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"tagesTest/internal/domain"
+)
+
+// ListFolder returns the files whose names start with prefix and that match
+// filter. With a delimiter, files whose names go on past the next delimiter
+// are rolled up into common prefixes instead, like folders; unless filter
+// selects some files only, folders without files are among them too.
+func (s *FileService) ListFolder(prefix, delimiter string, filter domain.FileFilter) ([]domain.File, []string, error) {
+	files, err := s.repo.ListFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	prefixes := make(map[string]bool)
+	var listed []domain.File
+	for _, file := range files {
+		rest, ok := strings.CutPrefix(file.Filename, prefix)
+		if !ok || !filter.Matches(file.Attributes) {
+			continue
+		}
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			prefixes[prefix+rest[:i+len(delimiter)]] = true
+			continue
+		}
+		listed = append(listed, file)
+	}
+	if delimiter == "" {
+		return listed, nil, nil
+	}
+	if !filter.IsZero() {
+		return listed, slices.Sorted(maps.Keys(prefixes)), nil
+	}
+
+	folders, err := s.repo.Folders()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, folder := range folders {
+		rest, ok := strings.CutPrefix(folder+"/", prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if i := strings.Index(rest, delimiter); i >= 0 {
+			prefixes[prefix+rest[:i+len(delimiter)]] = true
+		}
+	}
+	return listed, slices.Sorted(maps.Keys(prefixes)), nil
+}
+
+// CreateFolder creates folder, a slash-separated path, with its parents.
+func (s *FileService) CreateFolder(folder string) error {
+	return s.repo.CreateFolder(strings.Trim(folder, "/"))
+}
+
+// MoveFolder moves folder from with everything in it to to and returns how
+// many files were moved. With an owner, every file in from must belong to
+// it, otherwise domain.ErrNotOwner is returned.
+func (s *FileService) MoveFolder(from, to, owner string) (int, error) {
+	return s.repo.MoveFolder(strings.Trim(from, "/"), strings.Trim(to, "/"), owner)
+}
+
+// DeleteFolder removes folder. With recursive, the files in it are deleted
+// first as DeleteFile does, otherwise a folder holding files fails with
+// domain.ErrFolderNotEmpty. It returns how many files were deleted.
+func (s *FileService) DeleteFolder(folder string, recursive bool, retention time.Duration) (int, error) {
+	folder = strings.Trim(folder, "/")
+	deleted := 0
+	if recursive {
+		files, err := s.repo.FilesIn(folder)
+		if err != nil {
+			return 0, err
+		}
+		for _, file := range files {
+			_, err := s.DeleteFile(file.Filename, retention)
+			if errors.Is(err, domain.ErrFileNotFound) {
+				// deleted meanwhile
+				continue
+			}
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, s.repo.DeleteFolder(folder)
+}
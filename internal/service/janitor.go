@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// TrashJanitor periodically purges trash entries past their retention in
+// every bucket.
+type TrashJanitor struct {
+	buckets  *Buckets
+	interval time.Duration
+	logger   *slog.Logger
+	ticker   *ticker
+}
+
+func NewTrashJanitor(buckets *Buckets, interval time.Duration, logger *slog.Logger) *TrashJanitor {
+	return &TrashJanitor{buckets: buckets, interval: interval, logger: logger}
+}
+
+func (j *TrashJanitor) Start() {
+	j.ticker = startTicker(j.interval, j.purge)
+}
+
+func (j *TrashJanitor) Stop() {
+	j.ticker.stop()
+}
+
+func (j *TrashJanitor) purge(ctx context.Context) {
+	now := time.Now()
+	for _, service := range j.buckets.All() {
+		if ctx.Err() != nil {
+			return
+		}
+		bucket := slog.String("bucket", service.Bucket().Name)
+		purged, err := service.PurgeExpiredTrash(now)
+		if err != nil {
+			j.logger.Warn("failed to purge trash", bucket, slog.Int("purged", purged), slog.Any("error", err))
+			continue
+		}
+		if purged > 0 {
+			j.logger.Info("purged expired trash", bucket, slog.Int("purged", purged))
+		}
+	}
+}
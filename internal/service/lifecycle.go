@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"tagesTest/internal/domain"
+)
+
+// LifecycleResult counts the actions of one lifecycle run.
+type LifecycleResult struct {
+	Expired int
+	Moved   int
+}
+
+// EnforceLifecycle removes files whose TTL ran out and applies rules to the
+// rest. A file follows the first rule whose prefix matches its name. Errors
+// for single files do not stop the run and are returned together.
+func (s *FileService) EnforceLifecycle(ctx context.Context, now time.Time, rules []domain.LifecycleRule) (LifecycleResult, error) {
+	var result LifecycleResult
+	var errs []error
+	for _, name := range s.repo.ExpiredFiles(now) {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		expired, err := s.repo.ExpireFile(name, now, 0)
+		if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		if expired {
+			result.Expired++
+		}
+	}
+	if len(rules) == 0 {
+		return result, errors.Join(errs...)
+	}
+
+	files, err := s.repo.ListFiles()
+	if err != nil {
+		return result, err
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		rule, ok := matchRule(rules, file.Filename)
+		if !ok {
+			continue
+		}
+		if rule.ExpireAfter > 0 {
+			expired, err := s.repo.ExpireFile(file.Filename, now, rule.ExpireAfter)
+			if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+				errs = append(errs, fmt.Errorf("%s: %w", file.Filename, err))
+				continue
+			}
+			if expired {
+				result.Expired++
+				continue
+			}
+		}
+		if rule.ColdAfter > 0 && !file.Cold {
+			moved, err := s.repo.MoveToCold(file.Filename, now, rule.ColdAfter)
+			if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+				errs = append(errs, fmt.Errorf("%s: %w", file.Filename, err))
+			}
+			if moved {
+				result.Moved++
+			}
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+func matchRule(rules []domain.LifecycleRule, filename string) (domain.LifecycleRule, bool) {
+	for _, rule := range rules {
+		if strings.HasPrefix(filename, rule.Prefix) {
+			return rule, true
+		}
+	}
+	return domain.LifecycleRule{}, false
+}
+
+// LifecycleScheduler periodically enforces file TTLs and lifecycle rules in
+// every bucket. rules is called on every run, so rule changes apply without
+// a restart.
+type LifecycleScheduler struct {
+	buckets  *Buckets
+	interval time.Duration
+	rules    func() []domain.LifecycleRule
+	logger   *slog.Logger
+	ticker   *ticker
+}
+
+func NewLifecycleScheduler(
+	buckets *Buckets, interval time.Duration, rules func() []domain.LifecycleRule, logger *slog.Logger,
+) *LifecycleScheduler {
+	return &LifecycleScheduler{buckets: buckets, interval: interval, rules: rules, logger: logger}
+}
+
+func (l *LifecycleScheduler) Start() {
+	l.ticker = startTicker(l.interval, l.run)
+}
+
+func (l *LifecycleScheduler) Stop() {
+	l.ticker.stop()
+}
+
+func (l *LifecycleScheduler) run(ctx context.Context) {
+	now, rules := time.Now(), l.rules()
+	for _, service := range l.buckets.All() {
+		result, err := service.EnforceLifecycle(ctx, now, rules)
+		if ctx.Err() != nil {
+			return
+		}
+		attrs := []any{
+			slog.String("bucket", service.Bucket().Name),
+			slog.Int("expired", result.Expired),
+			slog.Int("moved_to_cold", result.Moved),
+		}
+		if err != nil {
+			l.logger.Warn("lifecycle run failed", append(attrs, slog.Any("error", err))...)
+			continue
+		}
+		if result.Expired > 0 || result.Moved > 0 {
+			l.logger.Info("lifecycle run finished", attrs...)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"strconv"
+
+	"tagesTest/internal/domain"
+)
+
+const (
+	defaultSearchPageSize = 50
+	maxSearchPageSize     = 1000
+)
+
+// SearchFiles returns a page of at most pageSize files matching q, best
+// first, the token of the next page, empty on the last one, and how many
+// files match in total. An empty pageToken starts from the best match.
+func (s *FileService) SearchFiles(
+	q domain.SearchQuery, pageToken string, pageSize int,
+) ([]domain.SearchResult, string, int, error) {
+	if q.MaxSize > 0 && q.MinSize > q.MaxSize ||
+		q.MaxWidth > 0 && q.MinWidth > q.MaxWidth ||
+		q.MaxHeight > 0 && q.MinHeight > q.MaxHeight {
+		return nil, "", 0, domain.ErrInvalidSearch
+	}
+	offset := 0
+	if pageToken != "" {
+		var err error
+		// the token is the offset of the page in the ranked results
+		if offset, err = strconv.Atoi(pageToken); err != nil || offset < 0 {
+			return nil, "", 0, domain.ErrInvalidSearch
+		}
+	}
+	if pageSize <= 0 {
+		pageSize = defaultSearchPageSize
+	}
+	q.Offset, q.Limit = offset, min(pageSize, maxSearchPageSize)
+
+	results, total, err := s.repo.Search(q)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	var next string
+	if end := q.Offset + len(results); end < total {
+		next = strconv.Itoa(end)
+	}
+	return results, next, total, nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// ticker runs a task right away and then every interval until stopped.
+type ticker struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func startTicker(interval time.Duration, task func(ctx context.Context)) *ticker {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &ticker{cancel: cancel, done: make(chan struct{})}
+	task(ctx)
+
+	go func() {
+		defer close(t.done)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				task(ctx)
+			}
+		}
+	}()
+	return t
+}
+
+// stop waits for a running task to return.
+func (t *ticker) stop() {
+	t.cancel()
+	<-t.done
+}
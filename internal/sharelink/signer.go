@@ -0,0 +1,86 @@
+package sharelink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"tagesTest/internal/domain"
+)
+
+// claims is the signed part of a token. The token carries enough to reject
+// forged or expired links without touching the metadata store.
+type claims struct {
+	ID           string `json:"id"`
+	Filename     string `json:"f"`
+	Bucket       string `json:"b,omitempty"`
+	ExpiresAt    int64  `json:"exp"`
+	MaxDownloads int    `json:"max,omitempty"`
+}
+
+// Signer issues and verifies share link tokens of the form
+// base64url(claims).base64url(HMAC-SHA256(claims)).
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+func (s *Signer) Sign(link domain.ShareLink) (string, error) {
+	payload, err := json.Marshal(claims{
+		ID:           link.ID,
+		Filename:     link.Filename,
+		Bucket:       link.Bucket,
+		ExpiresAt:    link.ExpiresAt.Unix(),
+		MaxDownloads: link.MaxDownloads,
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// Verify checks the signature and expiry of token and returns the link it
+// was issued for. Usage counters and revocation are not part of the token.
+func (s *Signer) Verify(token string, now time.Time) (domain.ShareLink, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return domain.ShareLink{}, domain.ErrShareLinkInvalid
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sum, s.mac(encoded)) {
+		return domain.ShareLink{}, domain.ErrShareLinkInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return domain.ShareLink{}, domain.ErrShareLinkInvalid
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.ID == "" {
+		return domain.ShareLink{}, domain.ErrShareLinkInvalid
+	}
+
+	link := domain.ShareLink{
+		ID:           c.ID,
+		Filename:     c.Filename,
+		Bucket:       c.Bucket,
+		ExpiresAt:    time.Unix(c.ExpiresAt, 0),
+		MaxDownloads: c.MaxDownloads,
+	}
+	if now.After(link.ExpiresAt) {
+		return domain.ShareLink{}, domain.ErrShareLinkExpired
+	}
+	return link, nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
@@ -0,0 +1,11 @@
+package storage
+
+import "path/filepath"
+
+// bucketsDir keeps every bucket as a storage of its own in bucketsDir/<name>.
+const bucketsDir = ".buckets"
+
+// BucketDir returns the directory of bucket inside the storage at baseDir.
+func BucketDir(baseDir, bucket string) string {
+	return filepath.Join(baseDir, bucketsDir, bucket)
+}
@@ -1,15 +1,29 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"tagesTest/internal/domain"
 	"time"
 )
 
+// PartialUploadSuffix marks files of uploads that are still in progress.
+const PartialUploadSuffix = ".part"
+
+// versionsDir keeps previous versions of files as versionsDir/<filename>/<version>.
+const versionsDir = ".versions"
+
+// trashDir keeps deleted files as trashDir/<id>/<filename>, with their
+// versions in trashDir/<id>/versionsDir.
+const trashDir = ".trash"
+
 type DiskStorage struct {
 	baseDir string
 	mu      sync.RWMutex
@@ -19,19 +33,89 @@ func NewDiskStorage(baseDir string) *DiskStorage {
 	return &DiskStorage{baseDir: baseDir}
 }
 
-func (s *DiskStorage) Save(filename string, reader io.Reader) error {
+// Save writes into a temporary file first and moves it into place once
+// reader is drained, so failed or interrupted uploads leave nothing behind.
+func (s *DiskStorage) Save(filename string, reader io.Reader) (int64, error) {
+	filePath, err := s.path(filename)
+	if err != nil {
+		return 0, err
+	}
+	tmpPath, n, err := s.writeTemp(filename, reader)
+	if err != nil {
+		return n, err
+	}
+	defer os.Remove(tmpPath)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if _, err := os.Stat(filePath); err == nil {
+		return n, domain.ErrFileExists
+	}
+	if err := makeParent(filePath); err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmpPath, filePath)
+}
 
-	filePath := filepath.Join(s.baseDir, filename)
-	file, err := os.Create(filePath)
+func (s *DiskStorage) Replace(filename string, reader io.Reader, keepVersion string) (int64, error) {
+	filePath, err := s.path(filename)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer file.Close()
+	var keptPath string
+	if keepVersion != "" {
+		if keptPath, err = s.versionPath(filename, keepVersion); err != nil {
+			return 0, err
+		}
+	}
+	tmpPath, n, err := s.writeTemp(filename, reader)
+	if err != nil {
+		return n, err
+	}
+	defer os.Remove(tmpPath)
 
-	_, err = io.Copy(file, reader)
-	return err
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := makeParent(filePath); err != nil {
+		return n, err
+	}
+	kept := false
+	if _, err := os.Stat(filePath); err == nil && keptPath != "" {
+		if err := os.MkdirAll(filepath.Dir(keptPath), 0755); err != nil {
+			return n, err
+		}
+		if err := os.Rename(filePath, keptPath); err != nil {
+			return n, err
+		}
+		kept = true
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		if kept {
+			os.Rename(keptPath, filePath)
+		}
+		return n, err
+	}
+	return n, nil
+}
+
+// writeTemp drains reader into a partial upload file next to the final one.
+func (s *DiskStorage) writeTemp(filename string, reader io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
+		return "", 0, err
+	}
+	file, err := os.CreateTemp(s.baseDir, "."+path.Base(filename)+".*"+PartialUploadSuffix)
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", n, err
+	}
+	return file.Name(), n, nil
 }
 
 func (s *DiskStorage) List() ([]domain.File, error) {
@@ -39,30 +123,549 @@ func (s *DiskStorage) List() ([]domain.File, error) {
 	defer s.mu.RUnlock()
 
 	var files []domain.File
-	err := filepath.Walk(s.baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
+	err := s.walk(func(name string, info os.FileInfo) {
+		if !info.IsDir() && !isPartialUpload(info.Name()) {
 			creationTime := getCreationTime(info)
 			files = append(files, domain.File{
-				Filename:  info.Name(),
+				Filename:  name,
+				Size:      info.Size(),
 				CreatedAt: creationTime,
 				UpdatedAt: info.ModTime(),
 			})
 		}
-		return nil
 	})
 	return files, err
 }
 
+// walk calls fn with the slash-separated name of every file and folder in
+// baseDir, skipping internal directories. The caller holds s.mu.
+func (s *DiskStorage) walk(fn func(name string, info os.FileInfo)) error {
+	return filepath.Walk(s.baseDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			// nothing has been stored yet
+			if filePath == s.baseDir && os.IsNotExist(err) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if filePath == s.baseDir {
+			return nil
+		}
+		// internal directories such as versionsDir are not part of the listing
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		name, err := filepath.Rel(s.baseDir, filePath)
+		if err != nil {
+			return err
+		}
+		fn(filepath.ToSlash(name), info)
+		return nil
+	})
+}
+
 func getCreationTime(info os.FileInfo) time.Time {
 	stat := info.Sys().(*syscall.Win32FileAttributeData)
 	return time.Unix(0, stat.CreationTime.Nanoseconds())
 }
 
 func (s *DiskStorage) Get(filename string) (io.ReadCloser, error) {
+	filePath, err := s.path(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if info, err := os.Stat(filePath); missing(err) || err == nil && info.IsDir() {
+		return nil, domain.ErrFileNotFound
+	}
+	file, err := os.Open(filePath)
+	if missing(err) {
+		return nil, domain.ErrFileNotFound
+	}
+	return file, err
+}
+
+func (s *DiskStorage) Stat(filename string) (domain.File, error) {
+	filePath, err := s.path(filename)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, err := os.Stat(filePath)
+	if missing(err) || err == nil && info.IsDir() {
+		return domain.File{}, domain.ErrFileNotFound
+	}
+	if err != nil {
+		return domain.File{}, err
+	}
+	return domain.File{
+		Filename:  filename,
+		Size:      info.Size(),
+		CreatedAt: getCreationTime(info),
+		UpdatedAt: info.ModTime(),
+		Path:      filePath,
+	}, nil
+}
+
+func (s *DiskStorage) Delete(filename string) error {
+	filePath, err := s.path(filename)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(filePath); missing(err) || err == nil && info.IsDir() {
+		return domain.ErrFileNotFound
+	}
+	if err := os.Remove(filePath); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.baseDir, versionsDir, filepath.FromSlash(filename)))
+}
+
+func (s *DiskStorage) GetVersion(filename, version string) (io.ReadCloser, error) {
+	versionPath, err := s.versionPath(filename, version)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	file, err := os.Open(versionPath)
+	if os.IsNotExist(err) {
+		return nil, domain.ErrVersionNotFound
+	}
+	return file, err
+}
+
+func (s *DiskStorage) DeleteVersion(filename, version string) error {
+	versionPath, err := s.versionPath(filename, version)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = os.Remove(versionPath)
+	if os.IsNotExist(err) {
+		return domain.ErrVersionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// drop the directory once the last version is gone
+	os.Remove(filepath.Dir(versionPath))
+	return nil
+}
+
+func (s *DiskStorage) Trash(filename, id string) error {
+	filePath, err := s.path(filename)
+	if err != nil {
+		return err
+	}
+	entryDir, err := s.trashPath(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(filePath); missing(err) || err == nil && info.IsDir() {
+		return domain.ErrFileNotFound
+	}
+	trashed := filepath.Join(entryDir, filepath.FromSlash(filename))
+	if err := os.MkdirAll(filepath.Dir(trashed), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(filePath, trashed); err != nil {
+		os.RemoveAll(entryDir)
+		return err
+	}
+	versions := filepath.Join(s.baseDir, versionsDir, filepath.FromSlash(filename))
+	if _, err := os.Stat(versions); err == nil {
+		if err := os.Rename(versions, filepath.Join(entryDir, versionsDir)); err != nil {
+			// the file must not end up apart from its versions
+			if restoreErr := os.Rename(trashed, filePath); restoreErr != nil {
+				return errors.Join(err, restoreErr)
+			}
+			os.RemoveAll(entryDir)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DiskStorage) Restore(id, filename string) error {
+	filePath, err := s.path(filename)
+	if err != nil {
+		return err
+	}
+	entryDir, err := s.trashPath(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trashed := filepath.Join(entryDir, filepath.FromSlash(filename))
+	if _, err := os.Stat(trashed); os.IsNotExist(err) {
+		return domain.ErrTrashEntryNotFound
+	}
+	if _, err := os.Stat(filePath); err == nil {
+		return domain.ErrFileExists
+	}
+	// the file's folder may have been deleted meanwhile
+	if err := makeParent(filePath); err != nil {
+		return err
+	}
+	if err := os.Rename(trashed, filePath); err != nil {
+		return err
+	}
+	trashedVersions := filepath.Join(entryDir, versionsDir)
+	if _, err := os.Stat(trashedVersions); err == nil {
+		versions := filepath.Join(s.baseDir, versionsDir, filepath.FromSlash(filename))
+		if err := os.MkdirAll(filepath.Dir(versions), 0755); err != nil {
+			return err
+		}
+		// versions left over from a file uploaded under the same name meanwhile
+		// are stale and give way to the restored ones
+		os.RemoveAll(versions)
+		if err := os.Rename(trashedVersions, versions); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(entryDir)
+}
+
+func (s *DiskStorage) PurgeTrash(id string) error {
+	entryDir, err := s.trashPath(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(entryDir); os.IsNotExist(err) {
+		return domain.ErrTrashEntryNotFound
+	}
+	return os.RemoveAll(entryDir)
+}
+
+func (s *DiskStorage) Rename(from, to string) error {
+	fromPath, err := s.path(from)
+	if err != nil {
+		return err
+	}
+	toPath, err := s.path(to)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(fromPath); missing(err) || err == nil && info.IsDir() {
+		return domain.ErrFileNotFound
+	}
+	if _, err := os.Stat(toPath); err == nil {
+		return domain.ErrFileExists
+	}
+	if err := makeParent(toPath); err != nil {
+		return err
+	}
+	if err := os.Rename(fromPath, toPath); err != nil {
+		return err
+	}
+	versions := filepath.Join(s.baseDir, versionsDir, filepath.FromSlash(from))
+	if _, err := os.Stat(versions); err != nil {
+		return nil
+	}
+	movedVersions := filepath.Join(s.baseDir, versionsDir, filepath.FromSlash(to))
+	err = os.MkdirAll(filepath.Dir(movedVersions), 0755)
+	if err == nil {
+		// versions left over from a file deleted under the new name are stale
+		os.RemoveAll(movedVersions)
+		err = os.Rename(versions, movedVersions)
+	}
+	if err != nil {
+		// the file must not end up apart from its versions
+		return errors.Join(err, os.Rename(toPath, fromPath))
+	}
+	return nil
+}
+
+// Copy hard links to to the content of from. Sharing it is safe because
+// files are never changed in place, every write replaces the file. Where
+// links are not supported the content is copied.
+func (s *DiskStorage) Copy(from, to string) (int64, error) {
+	fromPath, err := s.path(from)
+	if err != nil {
+		return 0, err
+	}
+	toPath, err := s.path(to)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := s.link(fromPath, toPath)
+	if !errors.Is(err, errLinkUnsupported) {
+		return n, err
+	}
+	file, err := s.Get(from)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return s.Save(to, file)
+}
+
+var errLinkUnsupported = errors.New("hard links are not supported")
+
+func (s *DiskStorage) link(fromPath, toPath string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(fromPath)
+	if missing(err) || err == nil && info.IsDir() {
+		return 0, domain.ErrFileNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(toPath); err == nil {
+		return 0, domain.ErrFileExists
+	}
+	if err := makeParent(toPath); err != nil {
+		return 0, err
+	}
+	if err := os.Link(fromPath, toPath); err != nil {
+		if os.IsExist(err) {
+			return 0, domain.ErrFileExists
+		}
+		return 0, errLinkUnsupported
+	}
+	return info.Size(), nil
+}
+
+func (s *DiskStorage) CreateFolder(folder string) error {
+	dirPath, err := s.folderPath(folder)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(dirPath); err == nil {
+		if !info.IsDir() {
+			return domain.ErrFileExists
+		}
+		return nil
+	}
+	if err := makeParent(dirPath); err != nil {
+		return err
+	}
+	return os.Mkdir(dirPath, 0755)
+}
+
+func (s *DiskStorage) Folders() ([]string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return os.Open(filename)
+
+	var folders []string
+	err := s.walk(func(name string, info os.FileInfo) {
+		if info.IsDir() {
+			folders = append(folders, name)
+		}
+	})
+	return folders, err
+}
+
+func (s *DiskStorage) MoveFolder(from, to string) error {
+	fromPath, err := s.folderPath(from)
+	if err != nil {
+		return err
+	}
+	toPath, err := s.folderPath(to)
+	if err != nil {
+		return err
+	}
+	if to == from || strings.HasPrefix(to, from+"/") {
+		return domain.ErrInvalidFilename
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(fromPath); err != nil || !info.IsDir() {
+		return domain.ErrFolderNotFound
+	}
+	if _, err := os.Stat(toPath); err == nil {
+		return domain.ErrFileExists
+	}
+	if err := makeParent(toPath); err != nil {
+		return err
+	}
+	if err := os.Rename(fromPath, toPath); err != nil {
+		return err
+	}
+	versions := filepath.Join(s.baseDir, versionsDir, filepath.FromSlash(from))
+	if _, err := os.Stat(versions); err == nil {
+		movedVersions := filepath.Join(s.baseDir, versionsDir, filepath.FromSlash(to))
+		if err := os.MkdirAll(filepath.Dir(movedVersions), 0755); err != nil {
+			return err
+		}
+		// versions left over from files deleted under the new name are stale
+		os.RemoveAll(movedVersions)
+		return os.Rename(versions, movedVersions)
+	}
+	return nil
+}
+
+func (s *DiskStorage) DeleteFolder(folder string) error {
+	dirPath, err := s.folderPath(folder)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(dirPath); err != nil || !info.IsDir() {
+		return domain.ErrFolderNotFound
+	}
+	empty := true
+	err = filepath.Walk(dirPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			empty = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return domain.ErrFolderNotEmpty
+	}
+	if err := os.RemoveAll(dirPath); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.baseDir, versionsDir, filepath.FromSlash(folder)))
+}
+
+// path maps filename, a slash-separated key, to a path inside baseDir,
+// rejecting anything that could escape it or clash with internal files.
+func (s *DiskStorage) path(filename string) (string, error) {
+	if !validKey(filename) || isPartialUpload(path.Base(filename)) {
+		return "", domain.ErrInvalidFilename
+	}
+	return filepath.Join(s.baseDir, filepath.FromSlash(filename)), nil
+}
+
+// validKey reports whether every folder and the name in key are usable.
+// Hidden folders are reserved for internal directories.
+func validKey(key string) bool {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, `\`) ||
+			segment == versionsDir || segment == trashDir || segment == bucketsDir {
+			return false
+		}
+		if i < len(segments)-1 && strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *DiskStorage) folderPath(folder string) (string, error) {
+	if !validKey(folder) || strings.HasPrefix(path.Base(folder), ".") {
+		return "", domain.ErrInvalidFilename
+	}
+	return filepath.Join(s.baseDir, filepath.FromSlash(folder)), nil
+}
+
+// makeParent creates the folders leading to filePath. A file in place of one
+// of them, or a folder in place of filePath, fails with domain.ErrFileExists.
+func makeParent(filePath string) error {
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		return domain.ErrFileExists
+	}
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		if info, statErr := os.Stat(pathErr.Path); statErr == nil && !info.IsDir() {
+			return domain.ErrFileExists
+		}
+	}
+	return err
+}
+
+// missing reports whether err means nothing is stored at a path, which is
+// also the case when a file stands where one of its folders should be.
+func missing(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+func (s *DiskStorage) versionPath(filename, version string) (string, error) {
+	if _, err := s.path(filename); err != nil {
+		return "", err
+	}
+	if version == "" || strings.HasPrefix(version, ".") || strings.ContainsAny(version, `/\`) {
+		return "", domain.ErrInvalidFilename
+	}
+	return filepath.Join(s.baseDir, versionsDir, filepath.FromSlash(filename), version), nil
+}
+
+func (s *DiskStorage) trashPath(id string) (string, error) {
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`) {
+		return "", domain.ErrTrashEntryNotFound
+	}
+	return filepath.Join(s.baseDir, trashDir, id), nil
+}
+
+func (s *DiskStorage) HealthCheck(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
+		return err
+	}
+	probe, err := os.CreateTemp(s.baseDir, ".healthcheck-*"+PartialUploadSuffix)
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// RemovePartialUploads deletes leftovers of uploads interrupted by a crash.
+func (s *DiskStorage) RemovePartialUploads() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.baseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isPartialUpload(entry.Name()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.baseDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isPartialUpload(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, PartialUploadSuffix)
 }
@@ -1,12 +1,53 @@
 package storage
 
 import (
+	"context"
 	"io"
 	"tagesTest/internal/domain"
 )
 
 type FileStorageInterface interface {
-	Save(filename string, reader io.Reader) error
+	// Save stores the content of reader under filename and returns the number
+	// of bytes written. It fails with domain.ErrFileExists if filename is taken.
+	Save(filename string, reader io.Reader) (int64, error)
+	// Replace stores the content of reader under filename whether it exists or
+	// not. Unless keepVersion is empty, the previous content stays available
+	// as that version of filename.
+	Replace(filename string, reader io.Reader, keepVersion string) (int64, error)
 	List() ([]domain.File, error)
 	Get(filename string) (io.ReadCloser, error)
+	Stat(filename string) (domain.File, error)
+	// Delete removes filename along with all of its kept versions.
+	Delete(filename string) error
+	GetVersion(filename, version string) (io.ReadCloser, error)
+	DeleteVersion(filename, version string) error
+	// Trash moves filename along with its kept versions into the trash as
+	// entry id.
+	Trash(filename, id string) error
+	// Restore moves trash entry id back to filename, which must be the name it
+	// was trashed under. It fails with domain.ErrFileExists if filename is taken.
+	Restore(id, filename string) error
+	// PurgeTrash permanently removes trash entry id.
+	PurgeTrash(id string) error
+	// Rename moves from along with its kept versions to to. It fails with
+	// domain.ErrFileExists if to is taken.
+	Rename(from, to string) error
+	// Copy stores the current content of from under to, without the kept
+	// versions, and returns its size. It fails with domain.ErrFileExists if
+	// to is taken.
+	Copy(from, to string) (int64, error)
+	// CreateFolder creates folder, a slash-separated path, along with its
+	// parents. Creating an existing folder succeeds.
+	CreateFolder(folder string) error
+	// Folders lists the slash-separated paths of all folders, empty ones
+	// included.
+	Folders() ([]string, error)
+	// MoveFolder moves folder from with its files and their versions to to,
+	// which must not exist.
+	MoveFolder(from, to string) error
+	// DeleteFolder removes folder and its subfolders. It fails with
+	// domain.ErrFolderNotEmpty while any of them holds a file.
+	DeleteFolder(folder string) error
+	// HealthCheck reports whether the backend is reachable and writable.
+	HealthCheck(ctx context.Context) error
 }
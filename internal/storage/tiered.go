@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+
+	"tagesTest/internal/domain"
+)
+
+// ColdMover is implemented by backends with a cold tier.
+type ColdMover interface {
+	// MoveToCold moves the current content of filename to the cold tier.
+	// Older versions of the file are dropped.
+	MoveToCold(filename string) error
+}
+
+// TieredStorage keeps new files in hot and serves files moved by MoveToCold
+// from cold. Only the current content of a file goes to cold: writing to a
+// cold file or trashing it brings it back to hot first, and versions and
+// the trash always live in hot.
+type TieredStorage struct {
+	hot  FileStorageInterface
+	cold FileStorageInterface
+}
+
+func NewTieredStorage(hot, cold FileStorageInterface) *TieredStorage {
+	return &TieredStorage{hot: hot, cold: cold}
+}
+
+func (s *TieredStorage) Save(filename string, reader io.Reader) (int64, error) {
+	if _, err := s.cold.Stat(filename); err == nil {
+		return 0, domain.ErrFileExists
+	}
+	return s.hot.Save(filename, reader)
+}
+
+func (s *TieredStorage) Replace(filename string, reader io.Reader, keepVersion string) (int64, error) {
+	if err := s.thaw(filename); err != nil {
+		return 0, err
+	}
+	return s.hot.Replace(filename, reader, keepVersion)
+}
+
+func (s *TieredStorage) List() ([]domain.File, error) {
+	files, err := s.hot.List()
+	if err != nil {
+		return nil, err
+	}
+	hot := make(map[string]bool, len(files))
+	for _, file := range files {
+		hot[file.Filename] = true
+	}
+	coldFiles, err := s.cold.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range coldFiles {
+		if !hot[file.Filename] {
+			file.Cold = true
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (s *TieredStorage) Get(filename string) (io.ReadCloser, error) {
+	file, err := s.hot.Get(filename)
+	if errors.Is(err, domain.ErrFileNotFound) {
+		return s.cold.Get(filename)
+	}
+	return file, err
+}
+
+func (s *TieredStorage) Stat(filename string) (domain.File, error) {
+	info, err := s.hot.Stat(filename)
+	if errors.Is(err, domain.ErrFileNotFound) {
+		info, err = s.cold.Stat(filename)
+		info.Cold = err == nil
+	}
+	return info, err
+}
+
+func (s *TieredStorage) Delete(filename string) error {
+	hotErr := s.hot.Delete(filename)
+	if hotErr != nil && !errors.Is(hotErr, domain.ErrFileNotFound) {
+		return hotErr
+	}
+	coldErr := s.cold.Delete(filename)
+	if errors.Is(coldErr, domain.ErrFileNotFound) && hotErr == nil {
+		return nil
+	}
+	return coldErr
+}
+
+func (s *TieredStorage) GetVersion(filename, version string) (io.ReadCloser, error) {
+	return s.hot.GetVersion(filename, version)
+}
+
+func (s *TieredStorage) DeleteVersion(filename, version string) error {
+	return s.hot.DeleteVersion(filename, version)
+}
+
+func (s *TieredStorage) Trash(filename, id string) error {
+	if err := s.thaw(filename); err != nil {
+		return err
+	}
+	return s.hot.Trash(filename, id)
+}
+
+func (s *TieredStorage) Restore(id, filename string) error {
+	if _, err := s.cold.Stat(filename); err == nil {
+		return domain.ErrFileExists
+	}
+	return s.hot.Restore(id, filename)
+}
+
+func (s *TieredStorage) PurgeTrash(id string) error {
+	return s.hot.PurgeTrash(id)
+}
+
+// Rename brings from back to hot before moving it, like any other write.
+func (s *TieredStorage) Rename(from, to string) error {
+	if _, err := s.cold.Stat(to); err == nil {
+		return domain.ErrFileExists
+	}
+	if err := s.thaw(from); err != nil {
+		return err
+	}
+	return s.hot.Rename(from, to)
+}
+
+// Copy always stores to in hot.
+func (s *TieredStorage) Copy(from, to string) (int64, error) {
+	if _, err := s.cold.Stat(to); err == nil {
+		return 0, domain.ErrFileExists
+	}
+	if _, err := s.hot.Stat(from); err == nil {
+		return s.hot.Copy(from, to)
+	}
+	file, err := s.cold.Get(from)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return s.hot.Save(to, file)
+}
+
+func (s *TieredStorage) CreateFolder(folder string) error {
+	if _, err := s.cold.Stat(folder); err == nil {
+		return domain.ErrFileExists
+	}
+	return s.hot.CreateFolder(folder)
+}
+
+func (s *TieredStorage) Folders() ([]string, error) {
+	folders, err := s.hot.Folders()
+	if err != nil {
+		return nil, err
+	}
+	coldFolders, err := s.cold.Folders()
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range coldFolders {
+		if !slices.Contains(folders, folder) {
+			folders = append(folders, folder)
+		}
+	}
+	return folders, nil
+}
+
+// MoveFolder moves folder in both tiers. It succeeds if either has it.
+func (s *TieredStorage) MoveFolder(from, to string) error {
+	if _, err := s.cold.Stat(to); err == nil {
+		return domain.ErrFileExists
+	}
+	hotErr := s.hot.MoveFolder(from, to)
+	if hotErr != nil && !errors.Is(hotErr, domain.ErrFolderNotFound) {
+		return hotErr
+	}
+	coldErr := s.cold.MoveFolder(from, to)
+	if errors.Is(coldErr, domain.ErrFolderNotFound) && hotErr == nil {
+		return nil
+	}
+	return coldErr
+}
+
+func (s *TieredStorage) DeleteFolder(folder string) error {
+	hotErr := s.hot.DeleteFolder(folder)
+	if hotErr != nil && !errors.Is(hotErr, domain.ErrFolderNotFound) {
+		return hotErr
+	}
+	coldErr := s.cold.DeleteFolder(folder)
+	if errors.Is(coldErr, domain.ErrFolderNotFound) && hotErr == nil {
+		return nil
+	}
+	return coldErr
+}
+
+func (s *TieredStorage) HealthCheck(ctx context.Context) error {
+	if err := s.hot.HealthCheck(ctx); err != nil {
+		return err
+	}
+	return s.cold.HealthCheck(ctx)
+}
+
+func (s *TieredStorage) MoveToCold(filename string) error {
+	file, err := s.hot.Get(filename)
+	if err != nil {
+		return err
+	}
+	_, err = s.cold.Save(filename, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	if err := s.hot.Delete(filename); err != nil {
+		s.cold.Delete(filename)
+		return err
+	}
+	return nil
+}
+
+// thaw moves filename back to hot if it is in cold.
+func (s *TieredStorage) thaw(filename string) error {
+	file, err := s.cold.Get(filename)
+	if errors.Is(err, domain.ErrFileNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.hot.Save(filename, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return s.cold.Delete(filename)
+}
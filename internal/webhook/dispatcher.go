@@ -0,0 +1,207 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"tagesTest/internal/config"
+	"tagesTest/internal/events"
+)
+
+// subscriptionBuffer is how far the dispatcher may fall behind the event bus
+// before it has to resubscribe.
+const subscriptionBuffer = 1024
+
+// Source provides the file events to deliver.
+type Source interface {
+	WatchFiles(epoch string, after uint64, buffer int) (*events.Subscription, error)
+}
+
+// Dispatcher POSTs every file event to all configured endpoints. Each
+// endpoint gets events from its own queue, which is kept on disk so
+// undelivered events survive a restart. Events are sent in order, but one
+// waiting for a retry does not hold back those after it; receivers order
+// them by sequence.
+type Dispatcher struct {
+	source    Source
+	client    *http.Client
+	cfg       config.Webhooks
+	endpoints []*endpoint
+	logger    *slog.Logger
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func NewDispatcher(cfg config.Webhooks, source Source, logger *slog.Logger) (*Dispatcher, error) {
+	d := &Dispatcher{
+		source: source,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		logger: logger,
+	}
+	for _, hook := range cfg.Endpoints {
+		ep, err := loadEndpoint(cfg.SpoolDir, hook)
+		if err != nil {
+			return nil, err
+		}
+		d.endpoints = append(d.endpoints, ep)
+	}
+	return d, nil
+}
+
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+
+	d.wg.Add(1 + len(d.endpoints))
+	go func() {
+		defer d.wg.Done()
+		d.run(ctx)
+	}()
+	for _, ep := range d.endpoints {
+		go func() {
+			defer d.wg.Done()
+			d.deliver(ctx, ep)
+		}()
+	}
+}
+
+// Stop queues the events already received and waits for the workers to
+// exit. Requests in progress are cancelled and retried after a restart.
+func (d *Dispatcher) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+		d.wg.Wait()
+	}
+	for _, ep := range d.endpoints {
+		if err := ep.close(); err != nil {
+			d.logger.Error("failed to close webhook spool", slog.String("url", ep.url), slog.Any("error", err))
+		}
+	}
+}
+
+// Status reports the delivery state of every endpoint.
+func (d *Dispatcher) Status() []Status {
+	statuses := make([]Status, 0, len(d.endpoints))
+	for _, ep := range d.endpoints {
+		statuses = append(statuses, ep.status())
+	}
+	return statuses
+}
+
+// run moves events from the bus into the endpoint queues, resubscribing from
+// the last seen sequence if the bus drops the subscription.
+func (d *Dispatcher) run(ctx context.Context) {
+	var last events.Event
+	for {
+		sub, err := d.source.WatchFiles(last.Epoch, last.Sequence, subscriptionBuffer)
+		if errors.Is(err, events.ErrSequenceUnavailable) {
+			d.logger.Warn("webhook events lost, continuing with new events",
+				slog.Uint64("after_sequence", last.Sequence))
+			last = events.Event{}
+			continue
+		}
+		if err != nil {
+			d.logger.Error("webhook dispatcher stopped", slog.Any("error", err))
+			return
+		}
+
+		last = d.consume(ctx, sub, last)
+		sub.Close()
+		if ctx.Err() != nil || errors.Is(sub.Err(), events.ErrClosed) {
+			return
+		}
+		d.logger.Warn("webhook subscription dropped, resubscribing", slog.Any("error", sub.Err()))
+	}
+}
+
+func (d *Dispatcher) consume(ctx context.Context, sub *events.Subscription, last events.Event) events.Event {
+	for {
+		select {
+		case event := <-sub.Events():
+			d.enqueue(event)
+			last = event
+		case <-sub.Done():
+			return last
+		case <-ctx.Done():
+			// keep what has already arrived, it is persisted with the queues
+			for {
+				select {
+				case event := <-sub.Events():
+					d.enqueue(event)
+					last = event
+				default:
+					return last
+				}
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) enqueue(event events.Event) {
+	if len(d.endpoints) == 0 {
+		return
+	}
+	payload, err := newPayload(event)
+	if err != nil {
+		d.logger.Error("failed to build webhook payload", slog.Any("error", err))
+		return
+	}
+	for _, ep := range d.endpoints {
+		dropped, err := ep.enqueue(payload, d.cfg.MaxPending)
+		if dropped > 0 {
+			d.logger.Warn("webhook queue full, dropped oldest events",
+				slog.String("url", ep.url), slog.Int("dropped", dropped), slog.Int("max_pending", d.cfg.MaxPending))
+		}
+		if err != nil {
+			d.logger.Error("failed to persist webhook event",
+				slog.String("url", ep.url), slog.Uint64("sequence", event.Sequence), slog.Any("error", err))
+		}
+	}
+}
+
+// deliver sends the queued events of ep as they become due. After a failed
+// attempt the endpoint rests with exponential backoff, and the event itself
+// is retried after its own backoff while later events go ahead.
+func (d *Dispatcher) deliver(ctx context.Context, ep *endpoint) {
+	for {
+		next, wait, ok := ep.next(time.Now())
+		if !ok {
+			select {
+			case <-ep.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ep.wake:
+				// a new event may be due before the one waited for
+				timer.Stop()
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+			continue
+		}
+
+		err := d.send(ctx, ep, next.Payload)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			d.logger.Warn("webhook delivery failed", slog.String("url", ep.url),
+				slog.String("id", next.Payload.ID), slog.Int("attempt", next.Attempts+1), slog.Any("error", err))
+		}
+		if err := ep.record(next.Payload.ID, err, d.cfg); err != nil {
+			d.logger.Error("failed to persist webhook queue", slog.String("url", ep.url), slog.Any("error", err))
+		}
+	}
+}
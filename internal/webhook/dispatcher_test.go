@@ -0,0 +1,429 @@
+package webhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"tagesTest/internal/config"
+	"tagesTest/internal/domain"
+	"tagesTest/internal/events"
+)
+
+const testSecret = "test-secret"
+
+// busSource feeds a dispatcher from a bus and tells when it has subscribed,
+// so that tests do not publish events before anyone listens.
+type busSource struct {
+	bus        *events.Bus
+	once       sync.Once
+	subscribed chan struct{}
+}
+
+func newBusSource() *busSource {
+	return &busSource{bus: events.NewBus(100, 10), subscribed: make(chan struct{})}
+}
+
+func (s *busSource) WatchFiles(epoch string, after uint64, buffer int) (*events.Subscription, error) {
+	sub, err := s.bus.Subscribe(epoch, after, buffer)
+	s.once.Do(func() { close(s.subscribed) })
+	return sub, err
+}
+
+func (s *busSource) publish(t *testing.T, filenames ...string) {
+	t.Helper()
+	select {
+	case <-s.subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher did not subscribe")
+	}
+	for _, filename := range filenames {
+		s.bus.Publish(events.Created, domain.File{Filename: filename, Size: 1})
+	}
+}
+
+// request is a webhook request as seen by the receiver.
+type request struct {
+	header  http.Header
+	body    []byte
+	payload Payload
+	status  int
+	at      time.Time
+}
+
+// receiver is a webhook endpoint answering with the status reply returns
+// for each request.
+type receiver struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	reqs   []request
+	reply  func(p Payload, attempt int) int
+}
+
+func (rc *receiver) setReply(reply func(p Payload, attempt int) int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.reply = reply
+}
+
+func newReceiver(t *testing.T, reply func(p Payload, attempt int) int) *receiver {
+	rc := &receiver{reply: reply}
+	rc.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+			return
+		}
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+
+		rc.mu.Lock()
+		attempt := 1
+		for _, prev := range rc.reqs {
+			if prev.payload.ID == p.ID {
+				attempt++
+			}
+		}
+		status := rc.reply(p, attempt)
+		rc.reqs = append(rc.reqs, request{
+			header: r.Header.Clone(), body: body, payload: p, status: status, at: time.Now(),
+		})
+		rc.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rc.server.Close)
+	return rc
+}
+
+func (rc *receiver) requests() []request {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]request(nil), rc.reqs...)
+}
+
+// delivered returns the filenames of the requests answered with 2xx, in
+// the order they arrived.
+func (rc *receiver) delivered() []string {
+	var names []string
+	for _, req := range rc.requests() {
+		if req.status < 300 {
+			names = append(names, req.payload.File.Filename)
+		}
+	}
+	return names
+}
+
+func always(status int) func(Payload, int) int {
+	return func(Payload, int) int { return status }
+}
+
+func testConfig(t *testing.T, dir string) config.Webhooks {
+	if dir == "" {
+		dir = t.TempDir()
+	}
+	return config.Webhooks{
+		SpoolDir:       dir,
+		MaxPending:     100,
+		Timeout:        5 * time.Second,
+		MaxAttempts:    5,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+	}
+}
+
+func startDispatcher(t *testing.T, cfg config.Webhooks, url string, source Source) *Dispatcher {
+	t.Helper()
+	cfg.Endpoints = []config.Webhook{{URL: url, Secret: testSecret}}
+	d, err := NewDispatcher(cfg, source, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Start()
+	t.Cleanup(d.Stop)
+	return d
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcherSignsRequests(t *testing.T) {
+	rc := newReceiver(t, always(http.StatusOK))
+	source := newBusSource()
+	startDispatcher(t, testConfig(t, ""), rc.server.URL, source)
+
+	source.publish(t, "a.png")
+	waitFor(t, "the request", func() bool { return len(rc.requests()) == 1 })
+
+	req := rc.requests()[0]
+	timestamp := req.header.Get(HeaderTimestamp)
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		t.Fatalf("timestamp header %q: %v", timestamp, err)
+	}
+	if got, want := req.header.Get(HeaderSignature), Sign(testSecret, timestamp, req.body); got != want {
+		t.Fatalf("signature %q, want %q", got, want)
+	}
+	if got := req.header.Get(HeaderID); got == "" || got != req.payload.ID {
+		t.Fatalf("id header %q does not match payload id %q", got, req.payload.ID)
+	}
+	if got := req.header.Get(HeaderEvent); got != "created" {
+		t.Fatalf("event header %q, want created", got)
+	}
+	p := req.payload
+	if p.File.Filename != "a.png" || p.Sequence != 1 || p.Epoch != source.bus.Epoch() || p.Type != "created" {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	rc := newReceiver(t, func(_ Payload, attempt int) int {
+		if attempt < 3 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	source := newBusSource()
+	cfg := testConfig(t, "")
+	d := startDispatcher(t, cfg, rc.server.URL, source)
+
+	source.publish(t, "a.png")
+	waitFor(t, "the delivery", func() bool { return d.Status()[0].Delivered == 1 })
+
+	reqs := rc.requests()
+	if len(reqs) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(reqs))
+	}
+	for i := 1; i < len(reqs); i++ {
+		if reqs[i].payload.ID != reqs[0].payload.ID {
+			t.Fatal("the event id changed between retries")
+		}
+		// backoff waits at least half of the doubled delay
+		min := cfg.InitialBackoff << (i - 1) / 2
+		if gap := reqs[i].at.Sub(reqs[i-1].at); gap < min {
+			t.Fatalf("retry %d after %s, want at least %s", i, gap, min)
+		}
+	}
+	st := d.Status()[0]
+	if st.Pending != 0 || st.Failed != 0 || st.LastError == "" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	rc := newReceiver(t, always(http.StatusInternalServerError))
+	source := newBusSource()
+	cfg := testConfig(t, "")
+	cfg.MaxAttempts = 2
+	d := startDispatcher(t, cfg, rc.server.URL, source)
+
+	source.publish(t, "a.png")
+	waitFor(t, "the event to fail", func() bool { return d.Status()[0].Failed == 1 })
+
+	if got := len(rc.requests()); got != 2 {
+		t.Fatalf("got %d attempts, want 2", got)
+	}
+	if st := d.Status()[0]; st.Pending != 0 || st.Delivered != 0 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func TestDispatcherFailingEventDoesNotBlockOthers(t *testing.T) {
+	rc := newReceiver(t, func(p Payload, _ int) int {
+		if p.File.Filename == "bad.png" {
+			return http.StatusBadRequest
+		}
+		return http.StatusOK
+	})
+	source := newBusSource()
+	cfg := testConfig(t, "")
+	cfg.MaxAttempts = 100
+	cfg.InitialBackoff = 50 * time.Millisecond
+	cfg.MaxBackoff = time.Second
+	d := startDispatcher(t, cfg, rc.server.URL, source)
+
+	source.publish(t, "bad.png", "b.png", "c.png")
+	waitFor(t, "the later events", func() bool { return d.Status()[0].Delivered == 2 })
+
+	got := rc.delivered()
+	if len(got) != 2 || got[0] != "b.png" || got[1] != "c.png" {
+		t.Fatalf("delivered %v, want [b.png c.png]", got)
+	}
+	if st := d.Status()[0]; st.Pending != 1 {
+		t.Fatalf("pending %d, want the failing event only", st.Pending)
+	}
+}
+
+func TestDispatcherReplaysSpoolAfterRestart(t *testing.T) {
+	cfg := testConfig(t, "")
+	cfg.InitialBackoff = 300 * time.Millisecond
+	cfg.MaxBackoff = 300 * time.Millisecond
+
+	rc := newReceiver(t, always(http.StatusServiceUnavailable))
+	source := newBusSource()
+	d := startDispatcher(t, cfg, rc.server.URL, source)
+	source.publish(t, "a.png", "b.png", "c.png")
+	// stop while the endpoint rests after the first failed attempt
+	waitFor(t, "the events to be queued", func() bool {
+		st := d.Status()[0]
+		return st.Pending == 3 && !st.LastAttempt.IsZero()
+	})
+	d.Stop()
+	failed := rc.requests()
+	if len(failed) != 1 {
+		t.Fatalf("got %d attempts before the restart, want 1", len(failed))
+	}
+
+	rc.setReply(always(http.StatusOK))
+	restarted := startDispatcher(t, cfg, rc.server.URL, newBusSource())
+	waitFor(t, "the spooled events", func() bool { return restarted.Status()[0].Delivered == 3 })
+
+	ids := map[string]string{}
+	for _, req := range rc.requests()[1:] {
+		ids[req.payload.File.Filename] = req.payload.ID
+	}
+	if len(ids) != 3 || ids["b.png"] == "" || ids["c.png"] == "" {
+		t.Fatalf("delivered %v, want a.png, b.png and c.png", ids)
+	}
+	if ids["a.png"] != failed[0].payload.ID {
+		t.Fatalf("replayed event id %q, want the original %q", ids["a.png"], failed[0].payload.ID)
+	}
+}
+
+func TestDispatcherDropsOldestWhenFull(t *testing.T) {
+	cfg := testConfig(t, "")
+	cfg.MaxPending = 2
+	cfg.InitialBackoff = time.Hour
+	cfg.MaxBackoff = time.Hour
+
+	rc := newReceiver(t, always(http.StatusServiceUnavailable))
+	source := newBusSource()
+	d := startDispatcher(t, cfg, rc.server.URL, source)
+	source.publish(t, "a.png", "b.png", "c.png", "d.png")
+	waitFor(t, "the queue to fill", func() bool {
+		st := d.Status()[0]
+		return st.Dropped == 2 && st.Pending == 2
+	})
+	d.Stop()
+
+	ep, err := loadEndpoint(cfg.SpoolDir, config.Webhook{URL: rc.server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.close()
+	var names []string
+	for _, pending := range ep.spool.Pending {
+		names = append(names, pending.Payload.File.Filename)
+	}
+	if len(names) != 2 || names[0] != "c.png" || names[1] != "d.png" {
+		t.Fatalf("spooled %v, want [c.png d.png]", names)
+	}
+}
+
+func TestEndpointCompactsJournal(t *testing.T) {
+	cfg := testConfig(t, "")
+	ep, err := loadEndpoint(cfg.SpoolDir, config.Webhook{URL: "http://example.com/hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.close()
+
+	for i := range 3 * compactAfter {
+		p := Payload{ID: strconv.Itoa(i), Sequence: uint64(i + 1)}
+		if _, err := ep.enqueue(p, cfg.MaxPending); err != nil {
+			t.Fatal(err)
+		}
+		if err := ep.record(p.ID, nil, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ep.enqueue(Payload{ID: "last"}, cfg.MaxPending); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := countLines(t, ep.journal.path); lines > compactAfter+1 {
+		t.Fatalf("journal has %d records, want it compacted", lines)
+	}
+	ep.close()
+	reloaded, err := loadEndpoint(cfg.SpoolDir, config.Webhook{URL: "http://example.com/hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.close()
+	if pending := reloaded.spool.Pending; len(pending) != 1 || pending[0].Payload.ID != "last" {
+		t.Fatalf("reloaded queue %v, want the last event only", pending)
+	}
+}
+
+func TestEndpointCutsTornRecord(t *testing.T) {
+	cfg := testConfig(t, "")
+	hook := config.Webhook{URL: "http://example.com/hook"}
+	ep, err := loadEndpoint(cfg.SpoolDir, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ep.enqueue(Payload{ID: "a"}, cfg.MaxPending); err != nil {
+		t.Fatal(err)
+	}
+	ep.close()
+
+	// a crash in the middle of a write leaves half a record behind
+	file, err := os.OpenFile(ep.journal.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"op":"add","delivery":{"pay`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	ep, err = loadEndpoint(cfg.SpoolDir, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ep.enqueue(Payload{ID: "b"}, cfg.MaxPending); err != nil {
+		t.Fatal(err)
+	}
+	ep.close()
+
+	reloaded, err := loadEndpoint(cfg.SpoolDir, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.close()
+	pending := reloaded.spool.Pending
+	if len(pending) != 2 || pending[0].Payload.ID != "a" || pending[1].Payload.ID != "b" {
+		t.Fatalf("reloaded queue %v, want a and b", pending)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var n int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,262 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand/v2"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"tagesTest/internal/config"
+)
+
+// maxFailed is the number of given up deliveries kept per endpoint.
+const maxFailed = 100
+
+type delivery struct {
+	Payload     Payload   `json:"payload"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// spool is the queue of an endpoint.
+type spool struct {
+	URL     string      `json:"url"`
+	Pending []*delivery `json:"pending"`
+	Failed  []*delivery `json:"failed"`
+}
+
+// apply replays a journal record.
+func (q *spool) apply(rec record) {
+	switch rec.Op {
+	case opAdd:
+		q.Pending = append(q.Pending, rec.Delivery)
+	case opRetry:
+		if i := q.index(rec.Delivery.Payload.ID); i >= 0 {
+			q.Pending[i] = rec.Delivery
+		}
+	case opDone, opDrop:
+		q.remove(rec.ID)
+	case opFail:
+		q.remove(rec.Delivery.Payload.ID)
+		q.fail(rec.Delivery)
+	}
+}
+
+func (q *spool) index(id string) int {
+	for i, d := range q.Pending {
+		if d.Payload.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *spool) remove(id string) {
+	if i := q.index(id); i >= 0 {
+		q.Pending = append(q.Pending[:i], q.Pending[i+1:]...)
+	}
+}
+
+func (q *spool) fail(d *delivery) {
+	q.Failed = append(q.Failed, d)
+	if len(q.Failed) > maxFailed {
+		q.Failed = q.Failed[len(q.Failed)-maxFailed:]
+	}
+}
+
+// Status is the delivery state of an endpoint. Delivered and Dropped count
+// events since the server started.
+type Status struct {
+	URL           string    `json:"url"`
+	Pending       int       `json:"pending"`
+	Delivered     int       `json:"delivered"`
+	Failed        int       `json:"failed"`
+	Dropped       int       `json:"dropped"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastAttempt   time.Time `json:"last_attempt"`
+	LastDelivered time.Time `json:"last_delivered"`
+}
+
+type endpoint struct {
+	url    string
+	secret string
+	wake   chan struct{}
+
+	mu            sync.Mutex
+	spool         spool
+	journal       journal
+	delivered     int
+	dropped       int
+	lastError     string
+	lastAttempt   time.Time
+	lastDelivered time.Time
+	// failures counts failed attempts in a row; while it is not zero the
+	// endpoint rests until pausedUntil, so a receiver that is down is not
+	// flooded with every queued event
+	failures    int
+	pausedUntil time.Time
+}
+
+// loadEndpoint restores the queue of hook from dir.
+func loadEndpoint(dir string, hook config.Webhook) (*endpoint, error) {
+	sum := sha256.Sum256([]byte(hook.URL))
+	name := filepath.Join(dir, hex.EncodeToString(sum[:8]))
+	ep := &endpoint{
+		url:     hook.URL,
+		secret:  hook.Secret,
+		wake:    make(chan struct{}, 1),
+		spool:   spool{URL: hook.URL},
+		journal: journal{path: name + ".log"},
+	}
+
+	if err := ep.journal.replay(&ep.spool); err != nil {
+		return nil, err
+	}
+	// start from a snapshot, which also drops a record cut short by a crash
+	if err := ep.journal.compact(&ep.spool, true); err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
+
+// enqueue adds p to the queue. If the queue already holds maxPending events
+// the oldest ones are dropped to make room and their number is returned.
+func (e *endpoint) enqueue(p Payload, maxPending int) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var dropped int
+	for len(e.spool.Pending) >= maxPending {
+		oldest := e.spool.Pending[0]
+		e.spool.Pending = e.spool.Pending[1:]
+		dropped++
+		if err := e.journal.append(record{Op: opDrop, ID: oldest.Payload.ID}); err != nil {
+			return dropped, err
+		}
+	}
+	e.dropped += dropped
+
+	d := &delivery{Payload: p, NextAttempt: time.Now()}
+	e.spool.Pending = append(e.spool.Pending, d)
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	if err := e.journal.append(record{Op: opAdd, Delivery: d}); err != nil {
+		return dropped, err
+	}
+	return dropped, e.journal.compact(&e.spool, false)
+}
+
+// next returns the first queued event that is due at now. Otherwise it
+// returns how long to wait, ok is false if the queue is empty.
+func (e *endpoint) next(now time.Time) (next delivery, wait time.Duration, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.spool.Pending) == 0 {
+		return delivery{}, 0, false
+	}
+	if now.Before(e.pausedUntil) {
+		return delivery{}, e.pausedUntil.Sub(now), true
+	}
+	earliest := e.spool.Pending[0].NextAttempt
+	for _, d := range e.spool.Pending {
+		if !d.NextAttempt.After(now) {
+			return *d, 0, true
+		}
+		if d.NextAttempt.Before(earliest) {
+			earliest = d.NextAttempt
+		}
+	}
+	return delivery{}, earliest.Sub(now), true
+}
+
+// record applies the outcome of an attempt to deliver the event id. A
+// failed event is retried after its own backoff, and events queued after it
+// are delivered in the meantime.
+func (e *endpoint) record(id string, sendErr error, cfg config.Webhooks) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	e.lastAttempt = now
+	if sendErr == nil {
+		e.delivered++
+		e.lastDelivered = now
+		e.failures = 0
+		e.pausedUntil = time.Time{}
+	} else {
+		e.lastError = sendErr.Error()
+		e.failures++
+		e.pausedUntil = now.Add(backoff(e.failures, cfg.InitialBackoff, cfg.MaxBackoff))
+	}
+
+	i := e.spool.index(id)
+	if i < 0 {
+		// dropped from a full queue while it was being sent
+		return nil
+	}
+	var rec record
+	switch head := e.spool.Pending[i]; {
+	case sendErr == nil:
+		e.spool.remove(id)
+		rec = record{Op: opDone, ID: id}
+	case head.Attempts+1 >= cfg.MaxAttempts:
+		failed := *head
+		failed.Attempts++
+		failed.LastError = e.lastError
+		e.spool.remove(id)
+		e.spool.fail(&failed)
+		rec = record{Op: opFail, Delivery: &failed}
+	default:
+		retry := *head
+		retry.Attempts++
+		retry.LastError = e.lastError
+		retry.NextAttempt = now.Add(backoff(retry.Attempts, cfg.InitialBackoff, cfg.MaxBackoff))
+		e.spool.Pending[i] = &retry
+		rec = record{Op: opRetry, Delivery: &retry}
+	}
+	if err := e.journal.append(rec); err != nil {
+		return err
+	}
+	return e.journal.compact(&e.spool, false)
+}
+
+func (e *endpoint) status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return Status{
+		URL:           e.url,
+		Pending:       len(e.spool.Pending),
+		Delivered:     e.delivered,
+		Failed:        len(e.spool.Failed),
+		Dropped:       e.dropped,
+		LastError:     e.lastError,
+		LastAttempt:   e.lastAttempt,
+		LastDelivered: e.lastDelivered,
+	}
+}
+
+func (e *endpoint) close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.journal.close()
+}
+
+// backoff doubles the delay with every attempt up to max and spreads retries
+// of many events over the second half of the interval.
+func backoff(attempt int, initial, max time.Duration) time.Duration {
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// compactAfter is the number of journal records written before the journal
+// may be rewritten as a snapshot of the queue.
+const compactAfter = 1024
+
+// Journal operations. Every record but done and drop carries the whole
+// delivery, so replaying the journal in order rebuilds the queue.
+const (
+	opAdd   = "add"
+	opRetry = "retry"
+	opDone  = "done"
+	opFail  = "fail"
+	opDrop  = "drop"
+)
+
+type record struct {
+	Op       string    `json:"op"`
+	ID       string    `json:"id,omitempty"`
+	Delivery *delivery `json:"delivery,omitempty"`
+}
+
+// journal is the append-only log of queue changes of an endpoint. Appending
+// costs the same however long the queue is; once the log holds far more
+// records than the queue it is compacted into a snapshot.
+type journal struct {
+	path    string
+	file    *os.File
+	records int
+}
+
+// replay reads the queue from the journal at path. A record cut short by a
+// crash ends the replay and is cut off, so later records are not appended
+// after it.
+func (j *journal) replay(q *spool) error {
+	file, err := os.OpenFile(j.path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				return file.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return file.Truncate(offset)
+		}
+		q.apply(rec)
+		offset += int64(len(line))
+		j.records++
+	}
+}
+
+// append writes rec to the end of the journal.
+func (j *journal) append(rec record) error {
+	if j.file == nil {
+		if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		j.file = file
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	j.records++
+	return nil
+}
+
+// compact replaces the journal with the records of q alone if it has grown
+// well beyond them, or always if force is set.
+func (j *journal) compact(q *spool, force bool) error {
+	live := len(q.Pending) + len(q.Failed)
+	if !force && (j.records < compactAfter || j.records < 4*live) {
+		return nil
+	}
+
+	dir := filepath.Dir(j.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, "."+filepath.Base(j.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, d := range q.Failed {
+		if err := enc.Encode(record{Op: opFail, Delivery: d}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	for _, d := range q.Pending {
+		if err := enc.Encode(record{Op: opAdd, Delivery: d}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// the journal has to be closed before it can be replaced on Windows
+	if err := j.close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), j.path); err != nil {
+		return err
+	}
+	j.records = live
+	return nil
+}
+
+func (j *journal) close() error {
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tagesTest/internal/events"
+)
+
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload is the JSON body of a webhook request. ID is unique per event and
+// stays the same across retries, so receivers can drop duplicates.
+type Payload struct {
+	ID       string    `json:"id"`
+	Epoch    string    `json:"epoch"`
+	Sequence uint64    `json:"sequence"`
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	File     File      `json:"file"`
+}
+
+type File struct {
+	Bucket    string    `json:"bucket,omitempty"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newPayload(event events.Event) (Payload, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Payload{}, err
+	}
+	return Payload{
+		ID:       hex.EncodeToString(id),
+		Epoch:    event.Epoch,
+		Sequence: event.Sequence,
+		Type:     event.Type.String(),
+		Time:     event.Time,
+		File: File{
+			Bucket:    event.File.Bucket,
+			Filename:  event.File.Filename,
+			Size:      event.File.Size,
+			CreatedAt: event.File.CreatedAt,
+			UpdatedAt: event.File.UpdatedAt,
+		},
+	}, nil
+}
+
+// Sign returns the signature header value for body sent at timestamp:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>".
+func Sign(secret, timestamp string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(timestamp))
+	m.Write([]byte("."))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+func (d *Dispatcher) send(ctx context.Context, ep *endpoint, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, p.ID)
+	req.Header.Set(HeaderEvent, p.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(ep.secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain a bit of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const minBandwidthBurst = 64 * 1024
+
+// Bandwidth throttles byte throughput with one global budget shared by all
+// clients and a separate budget for each client. Rates are in bytes per
+// second; zero means unlimited.
+type Bandwidth struct {
+	global     *TokenBucket
+	mu         sync.Mutex
+	clientRate int64
+	clients    map[string]*bandwidthClient
+	idleTTL    time.Duration
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+type bandwidthClient struct {
+	bucket   *TokenBucket
+	lastSeen time.Time
+}
+
+func NewBandwidth(globalRate, clientRate int64) *Bandwidth {
+	return &Bandwidth{
+		global:     NewTokenBucket(float64(globalRate), bandwidthBurst(globalRate)),
+		clientRate: clientRate,
+		clients:    make(map[string]*bandwidthClient),
+		idleTTL:    defaultIdleTTL,
+		lastSweep:  time.Now(),
+		now:        time.Now,
+	}
+}
+
+// SetRates changes both budgets at runtime, including for clients that are
+// in the middle of a transfer.
+func (b *Bandwidth) SetRates(globalRate, clientRate int64) {
+	b.global.SetRate(float64(globalRate), bandwidthBurst(globalRate))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clientRate = clientRate
+	for _, c := range b.clients {
+		c.bucket.SetRate(float64(clientRate), bandwidthBurst(clientRate))
+	}
+}
+
+// WaitN blocks until client may transfer n more bytes.
+func (b *Bandwidth) WaitN(ctx context.Context, client string, n int) error {
+	if err := b.client(client).WaitN(ctx, n); err != nil {
+		return err
+	}
+	return b.global.WaitN(ctx, n)
+}
+
+func (b *Bandwidth) client(key string) *TokenBucket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if now.Sub(b.lastSweep) > b.idleTTL {
+		for k, c := range b.clients {
+			if now.Sub(c.lastSeen) > b.idleTTL {
+				delete(b.clients, k)
+			}
+		}
+		b.lastSweep = now
+	}
+
+	c, ok := b.clients[key]
+	if !ok {
+		c = &bandwidthClient{bucket: newTokenBucket(float64(b.clientRate), bandwidthBurst(b.clientRate), b.now)}
+		b.clients[key] = c
+	}
+	c.lastSeen = now
+	return c.bucket
+}
+
+func bandwidthBurst(rate int64) int {
+	if rate < minBandwidthBurst {
+		return minBandwidthBurst
+	}
+	return int(rate)
+}
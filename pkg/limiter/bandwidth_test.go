@@ -0,0 +1,163 @@
+package limiter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestBandwidth(globalRate, clientRate int64, clock *fakeClock) *Bandwidth {
+	b := NewBandwidth(globalRate, clientRate)
+	b.global = newTokenBucket(float64(globalRate), bandwidthBurst(globalRate), clock.now)
+	b.now = clock.now
+	b.lastSweep = clock.now()
+	return b
+}
+
+// throttledReader charges every read to client, as the transfer readers of
+// the server do.
+type throttledReader struct {
+	r         io.Reader
+	bandwidth *Bandwidth
+	client    string
+}
+
+func (r *throttledReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	if n > 0 {
+		if waitErr := r.bandwidth.WaitN(context.Background(), r.client, n); waitErr != nil {
+			return 0, waitErr
+		}
+	}
+	return n, err
+}
+
+// readThrottled reads size bytes in small chunks as client and returns how
+// long it took.
+func readThrottled(t *testing.T, b *Bandwidth, client string, size int) time.Duration {
+	t.Helper()
+	r := &throttledReader{r: bytes.NewReader(make([]byte, size)), bandwidth: b, client: client}
+	start := time.Now()
+	n, err := io.CopyBuffer(io.Discard, r, make([]byte, 8*1024))
+	if err != nil {
+		t.Error(err)
+	}
+	if n != int64(size) {
+		t.Errorf("read %d bytes, want %d", n, size)
+	}
+	return time.Since(start)
+}
+
+func TestBandwidthThrottlesReadRate(t *testing.T) {
+	b := NewBandwidth(0, minBandwidthBurst)
+
+	// the first burst is free, the remaining half second of data is not
+	elapsed := readThrottled(t, b, "a", minBandwidthBurst+minBandwidthBurst/2)
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("read took %s, want about 500ms", elapsed)
+	}
+}
+
+func TestBandwidthSharesGlobalRate(t *testing.T) {
+	b := NewBandwidth(minBandwidthBurst, 0)
+
+	// two clients without a limit of their own share the global budget
+	var wg sync.WaitGroup
+	for _, client := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readThrottled(t, b, client, minBandwidthBurst*3/4)
+		}()
+	}
+	start := time.Now()
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("reads took %s, want about 500ms", elapsed)
+	}
+}
+
+func TestBandwidthIsolatesClients(t *testing.T) {
+	b := newTestBandwidth(0, minBandwidthBurst, newFakeClock())
+	if err := b.WaitN(context.Background(), "a", minBandwidthBurst); err != nil {
+		t.Fatal(err)
+	}
+
+	// a has spent its burst, b has its own
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.WaitN(ctx, "b", minBandwidthBurst); err != nil {
+		t.Fatalf("b: %v", err)
+	}
+	if err := b.WaitN(ctx, "a", minBandwidthBurst); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("a over its budget: got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestBandwidthCancelledWaitRefunds(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBandwidth(0, minBandwidthBurst, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.WaitN(ctx, "a", 2*minBandwidthBurst); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	// the cancelled transfer paid its tokens back
+	if err := b.WaitN(context.Background(), "a", minBandwidthBurst); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBandwidthRefills(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBandwidth(0, minBandwidthBurst, clock)
+	if err := b.WaitN(context.Background(), "a", minBandwidthBurst); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.WaitN(ctx, "a", minBandwidthBurst); err != nil {
+		t.Fatalf("after a second of refill: %v", err)
+	}
+}
+
+func TestBandwidthEvictsIdleClients(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBandwidth(0, minBandwidthBurst, clock)
+	if err := b.WaitN(context.Background(), "a", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(defaultIdleTTL + time.Second)
+	if err := b.WaitN(context.Background(), "b", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.clients["a"]; ok {
+		t.Fatal("idle client was not evicted")
+	}
+	if _, ok := b.clients["b"]; !ok {
+		t.Fatal("active client is missing")
+	}
+}
+
+func TestBandwidthSetRates(t *testing.T) {
+	b := newTestBandwidth(0, minBandwidthBurst, newFakeClock())
+	if err := b.WaitN(context.Background(), "a", minBandwidthBurst); err != nil {
+		t.Fatal(err)
+	}
+
+	// lifting the limit applies to a client in the middle of a transfer
+	b.SetRates(0, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.WaitN(ctx, "a", 10*minBandwidthBurst); err != nil {
+		t.Fatalf("after lifting the limit: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package limiter
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIdleTTL        = 10 * time.Minute
+	concurrencyRetryAfter = time.Second
+)
+
+// ClientLimit describes the budget of a single client. Zero values disable
+// the corresponding limit.
+type ClientLimit struct {
+	Rate          float64
+	Burst         int
+	MaxConcurrent int
+}
+
+// LimitError is returned when a client exceeds its budget.
+type LimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Reason, e.RetryAfter)
+}
+
+// RetryAfterSeconds rounds RetryAfter up to whole seconds, as used by
+// Retry-After style headers.
+func (e *LimitError) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+type clientState struct {
+	bucket   *TokenBucket
+	streams  *Limiter
+	lastSeen time.Time
+}
+
+// KeyedLimiter applies a ClientLimit independently to every key, e.g. a peer
+// address or an authenticated principal.
+type KeyedLimiter struct {
+	limit     ClientLimit
+	idleTTL   time.Duration
+	mu        sync.Mutex
+	clients   map[string]*clientState
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewKeyedLimiter(limit ClientLimit) *KeyedLimiter {
+	return &KeyedLimiter{
+		limit:     limit,
+		idleTTL:   defaultIdleTTL,
+		clients:   make(map[string]*clientState),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Acquire charges one request to key. On success the returned release func
+// must be called once the request is finished.
+func (k *KeyedLimiter) Acquire(key string) (func(), error) {
+	bucket, streams := k.client(key)
+
+	if ok, wait := bucket.Allow(); !ok {
+		return nil, &LimitError{Reason: "request rate limit exceeded", RetryAfter: wait}
+	}
+	if streams == nil {
+		return func() {}, nil
+	}
+	if !streams.TryAcquire() {
+		return nil, &LimitError{Reason: "concurrent stream limit exceeded", RetryAfter: concurrencyRetryAfter}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { streams.Release() })
+	}, nil
+}
+
+// SetLimit applies a new budget to known and future clients.
+func (k *KeyedLimiter) SetLimit(limit ClientLimit) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.limit = limit
+	for _, state := range k.clients {
+		state.bucket.SetRate(limit.Rate, limit.Burst)
+		switch {
+		case limit.MaxConcurrent <= 0:
+			state.streams = nil
+		case state.streams == nil:
+			state.streams = NewLimiter(limit.MaxConcurrent)
+		default:
+			state.streams.SetLimit(limit.MaxConcurrent)
+		}
+	}
+}
+
+func (k *KeyedLimiter) client(key string) (*TokenBucket, *Limiter) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	if now.Sub(k.lastSweep) > k.idleTTL {
+		k.sweep(now)
+	}
+
+	state, ok := k.clients[key]
+	if !ok {
+		state = &clientState{bucket: newTokenBucket(k.limit.Rate, k.limit.Burst, k.now)}
+		if k.limit.MaxConcurrent > 0 {
+			state.streams = NewLimiter(k.limit.MaxConcurrent)
+		}
+		k.clients[key] = state
+	}
+	state.lastSeen = now
+	return state.bucket, state.streams
+}
+
+func (k *KeyedLimiter) sweep(now time.Time) {
+	for key, state := range k.clients {
+		if now.Sub(state.lastSeen) < k.idleTTL {
+			continue
+		}
+		if state.streams != nil && state.streams.InUse() > 0 {
+			continue
+		}
+		delete(k.clients, key)
+	}
+	k.lastSweep = now
+}
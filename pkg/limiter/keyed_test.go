@@ -0,0 +1,120 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestKeyedLimiter(limit ClientLimit, clock *fakeClock) *KeyedLimiter {
+	k := NewKeyedLimiter(limit)
+	k.now = clock.now
+	k.lastSweep = clock.now()
+	return k
+}
+
+func TestKeyedLimiterIsolatesKeys(t *testing.T) {
+	clock := newFakeClock()
+	k := newTestKeyedLimiter(ClientLimit{Rate: 1, Burst: 2}, clock)
+
+	for i := range 2 {
+		if _, err := k.Acquire("a"); err != nil {
+			t.Fatalf("request %d of a: %v", i+1, err)
+		}
+	}
+	_, err := k.Acquire("a")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("third request of a: got %v, want a LimitError", err)
+	}
+	if limitErr.RetryAfter != time.Second {
+		t.Fatalf("RetryAfter = %s, want 1s", limitErr.RetryAfter)
+	}
+
+	// a has spent its budget, b still has its own
+	for i := range 2 {
+		if _, err := k.Acquire("b"); err != nil {
+			t.Fatalf("request %d of b: %v", i+1, err)
+		}
+	}
+
+	clock.advance(time.Second)
+	if _, err := k.Acquire("a"); err != nil {
+		t.Fatalf("a after a refill: %v", err)
+	}
+}
+
+func TestKeyedLimiterConcurrentStreams(t *testing.T) {
+	k := newTestKeyedLimiter(ClientLimit{MaxConcurrent: 1}, newFakeClock())
+
+	release, err := k.Acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Acquire("a"); err == nil {
+		t.Fatal("second stream of a was allowed")
+	}
+	releaseB, err := k.Acquire("b")
+	if err != nil {
+		t.Fatalf("stream of b: %v", err)
+	}
+	defer releaseB()
+
+	release()
+	release() // a second call must not free a slot twice
+	if _, err := k.Acquire("a"); err != nil {
+		t.Fatalf("stream of a after release: %v", err)
+	}
+}
+
+func TestKeyedLimiterEvictsIdleClients(t *testing.T) {
+	clock := newFakeClock()
+	k := newTestKeyedLimiter(ClientLimit{Rate: 1, Burst: 1, MaxConcurrent: 1}, clock)
+
+	release, err := k.Acquire("idle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if _, err := k.Acquire("busy"); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(defaultIdleTTL + time.Second)
+	// the sweep runs on the next request
+	if _, err := k.Acquire("other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := k.clients["idle"]; ok {
+		t.Fatal("idle client was not evicted")
+	}
+	if _, ok := k.clients["busy"]; !ok {
+		t.Fatal("client with an open stream was evicted")
+	}
+
+	// an evicted client starts over with a full bucket
+	if _, err := k.Acquire("idle"); err != nil {
+		t.Fatalf("evicted client: %v", err)
+	}
+}
+
+func TestKeyedLimiterSetLimit(t *testing.T) {
+	k := newTestKeyedLimiter(ClientLimit{Rate: 1, Burst: 1}, newFakeClock())
+	if _, err := k.Acquire("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	k.SetLimit(ClientLimit{Rate: 1, Burst: 1, MaxConcurrent: 1})
+	if _, err := k.Acquire("a"); err == nil {
+		t.Fatal("rate limit was lost by SetLimit")
+	}
+	if _, err := k.Acquire("b"); err != nil {
+		t.Fatal(err)
+	}
+	k.SetLimit(ClientLimit{})
+	for range 10 {
+		if _, err := k.Acquire("a"); err != nil {
+			t.Fatalf("after lifting the limits: %v", err)
+		}
+	}
+}
@@ -1,15 +1,29 @@
 package limiter
 
 import (
+	"container/list"
 	"context"
 	"errors"
 	"sync"
 )
 
+var (
+	ErrWeightExceedsLimit = errors.New("requested weight exceeds limit")
+	ErrInvalidRelease     = errors.New("release weight must be positive and at most the weight in use")
+)
+
+type waiter struct {
+	n     int
+	ready chan struct{}
+}
+
+// Limiter is a weighted semaphore. Blocked callers are woken in FIFO order,
+// so a large request at the head of the queue is not starved by smaller ones.
 type Limiter struct {
-	limit int
-	count int
-	mu    sync.Mutex
+	limit   int
+	count   int
+	mu      sync.Mutex
+	waiters list.List
 }
 
 func NewLimiter(limit int) *Limiter {
@@ -20,34 +34,130 @@ func NewLimiter(limit int) *Limiter {
 }
 
 func (l *Limiter) Acquire(ctx context.Context) error {
+	return l.AcquireN(ctx, 1)
+}
+
+// AcquireN blocks until n slots are available or ctx is done.
+func (l *Limiter) AcquireN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	if n > l.limit {
+		l.mu.Unlock()
+		return ErrWeightExceedsLimit
+	}
+	if l.limit-l.count >= n && l.waiters.Len() == 0 {
+		l.count += n
+		l.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(waiter{n: n, ready: ready})
+	l.mu.Unlock()
 
-	for l.count >= l.limit {
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
 		select {
-		case <-ctx.Done():
-			return ctx.Err()
+		case <-ready:
+			// acquired right after cancellation, give the slots back
+			l.count -= n
+			l.notifyWaiters()
 		default:
-			l.mu.Unlock()
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-				l.mu.Lock()
+			isFront := l.waiters.Front() == elem
+			l.waiters.Remove(elem)
+			if isFront && l.limit > l.count {
+				l.notifyWaiters()
 			}
 		}
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-ready:
+		return nil
 	}
+}
 
-	l.count++
-	return nil
+func (l *Limiter) TryAcquire() bool {
+	return l.TryAcquireN(1)
+}
+
+// TryAcquireN takes n slots without blocking and reports whether it succeeded.
+func (l *Limiter) TryAcquireN(n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n <= 0 {
+		return true
+	}
+	if l.limit-l.count >= n && l.waiters.Len() == 0 {
+		l.count += n
+		return true
+	}
+	return false
 }
 
 func (l *Limiter) Release() error {
+	return l.ReleaseN(1)
+}
+
+// ReleaseN gives back n slots. Releasing nothing or more than is in use
+// returns ErrInvalidRelease and leaves the limiter unchanged.
+func (l *Limiter) ReleaseN(n int) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if l.count <= 0 {
-		return errors.New("release called more times than acquire")
+	if n <= 0 || n > l.count {
+		return ErrInvalidRelease
 	}
-	l.count--
+	l.count -= n
+	l.notifyWaiters()
 	return nil
 }
+
+func (l *Limiter) InUse() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+func (l *Limiter) Waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waiters.Len()
+}
+
+// SetLimit changes the number of slots. Holders above a reduced limit keep
+// their slots; new callers wait until usage drops below the limit.
+func (l *Limiter) SetLimit(limit int) {
+	if limit <= 0 {
+		limit = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.notifyWaiters()
+}
+
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *Limiter) notifyWaiters() {
+	for {
+		next := l.waiters.Front()
+		if next == nil {
+			return
+		}
+		w := next.Value.(waiter)
+		if l.limit-l.count < w.n {
+			// keep FIFO order: don't let smaller requests overtake the head
+			return
+		}
+		l.count += w.n
+		l.waiters.Remove(next)
+		close(w.ready)
+	}
+}
@@ -0,0 +1,386 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterWakesWaitersInOrder(t *testing.T) {
+	l := NewLimiter(1)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	order := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			if err := l.Release(); err != nil {
+				t.Error(err)
+			}
+		}()
+		// enqueue the waiters one at a time so their order is known
+		waitFor(t, func() bool { return l.Waiting() == i+1 })
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(order)
+
+	want := 0
+	for got := range order {
+		if got != want {
+			t.Fatalf("waiter %d acquired in position %d", got, want)
+		}
+		want++
+	}
+}
+
+func TestLimiterHeadIsNotOvertaken(t *testing.T) {
+	l := NewLimiter(3)
+	if err := l.AcquireN(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	big := make(chan error, 1)
+	go func() { big <- l.AcquireN(context.Background(), 3) }()
+	waitFor(t, func() bool { return l.Waiting() == 1 })
+
+	// one slot is free, but the request of three ahead of it keeps it
+	if l.TryAcquireN(1) {
+		t.Fatal("TryAcquireN overtook a queued waiter")
+	}
+	small := make(chan error, 1)
+	go func() { small <- l.AcquireN(context.Background(), 1) }()
+	waitFor(t, func() bool { return l.Waiting() == 2 })
+
+	if err := l.ReleaseN(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-big; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-small:
+		t.Fatal("small request acquired while the limit was taken")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := l.ReleaseN(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-small; err != nil {
+		t.Fatal(err)
+	}
+	if got := l.InUse(); got != 1 {
+		t.Fatalf("InUse() = %d, want 1", got)
+	}
+}
+
+func TestLimiterCancelledHeadWakesNext(t *testing.T) {
+	l := NewLimiter(2)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	head := make(chan error, 1)
+	go func() { head <- l.AcquireN(ctx, 2) }()
+	waitFor(t, func() bool { return l.Waiting() == 1 })
+
+	next := make(chan error, 1)
+	go func() { next <- l.Acquire(context.Background()) }()
+	waitFor(t, func() bool { return l.Waiting() == 2 })
+
+	cancel()
+	if err := <-head; !errors.Is(err, context.Canceled) {
+		t.Fatalf("head: got %v, want context.Canceled", err)
+	}
+	select {
+	case err := <-next:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter behind a cancelled head was not woken")
+	}
+	if got := l.InUse(); got != 2 {
+		t.Fatalf("InUse() = %d, want 2", got)
+	}
+}
+
+func TestLimiterTryAcquireN(t *testing.T) {
+	l := NewLimiter(3)
+	if !l.TryAcquireN(2) {
+		t.Fatal("TryAcquireN(2) failed on an idle limiter")
+	}
+	if l.TryAcquireN(2) {
+		t.Fatal("TryAcquireN(2) succeeded with one slot free")
+	}
+	if !l.TryAcquire() {
+		t.Fatal("TryAcquire failed with one slot free")
+	}
+	if l.TryAcquire() {
+		t.Fatal("TryAcquire succeeded on a full limiter")
+	}
+	if !l.TryAcquireN(0) {
+		t.Fatal("TryAcquireN(0) failed")
+	}
+	if got := l.InUse(); got != 3 {
+		t.Fatalf("InUse() = %d, want 3", got)
+	}
+}
+
+func TestLimiterWeightExceedsLimit(t *testing.T) {
+	l := NewLimiter(2)
+	if err := l.AcquireN(context.Background(), 3); !errors.Is(err, ErrWeightExceedsLimit) {
+		t.Fatalf("got %v, want ErrWeightExceedsLimit", err)
+	}
+	if l.TryAcquireN(3) {
+		t.Fatal("TryAcquireN above the limit succeeded")
+	}
+	if got := l.Waiting(); got != 0 {
+		t.Fatalf("Waiting() = %d, want 0", got)
+	}
+}
+
+func TestLimiterInvalidRelease(t *testing.T) {
+	l := NewLimiter(2)
+	if err := l.Release(); !errors.Is(err, ErrInvalidRelease) {
+		t.Fatalf("Release on an idle limiter: got %v, want ErrInvalidRelease", err)
+	}
+	if err := l.AcquireN(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, -1, 3} {
+		if err := l.ReleaseN(n); !errors.Is(err, ErrInvalidRelease) {
+			t.Fatalf("ReleaseN(%d): got %v, want ErrInvalidRelease", n, err)
+		}
+	}
+	if got := l.InUse(); got != 2 {
+		t.Fatalf("InUse() = %d after invalid releases, want 2", got)
+	}
+}
+
+// TestLimiterStress mixes weighted acquisitions and cancellations from many
+// goroutines. Run it with -race: the holders must never exceed the limit and
+// every waiter must eventually be served or cancelled.
+func TestLimiterStress(t *testing.T) {
+	const (
+		limit      = 8
+		goroutines = 64
+		rounds     = 200
+	)
+	l := NewLimiter(limit)
+	var held atomic.Int64
+
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(g), 0))
+			for range rounds {
+				n := 1 + rng.IntN(limit)
+				ctx, cancel := context.Background(), context.CancelFunc(func() {})
+				if rng.IntN(4) == 0 {
+					ctx, cancel = context.WithTimeout(ctx, time.Duration(rng.IntN(200))*time.Microsecond)
+				}
+				err := l.AcquireN(ctx, n)
+				cancel()
+				if err != nil {
+					if !errors.Is(err, context.DeadlineExceeded) {
+						t.Errorf("AcquireN: %v", err)
+					}
+					continue
+				}
+				if total := held.Add(int64(n)); total > limit {
+					t.Errorf("%d slots held with a limit of %d", total, limit)
+				}
+				if rng.IntN(2) == 0 {
+					time.Sleep(time.Duration(rng.IntN(50)) * time.Microsecond)
+				}
+				held.Add(-int64(n))
+				if err := l.ReleaseN(n); err != nil {
+					t.Errorf("ReleaseN: %v", err)
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("stress test stalled with %d in use and %d waiting", l.InUse(), l.Waiting())
+	}
+
+	if got := l.InUse(); got != 0 {
+		t.Fatalf("InUse() = %d after all releases, want 0", got)
+	}
+	if got := l.Waiting(); got != 0 {
+		t.Fatalf("Waiting() = %d after all acquisitions, want 0", got)
+	}
+}
+
+func TestLimiterSetLimitWakesWaiters(t *testing.T) {
+	l := NewLimiter(1)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.Acquire(context.Background()) }()
+	waitFor(t, func() bool { return l.Waiting() == 1 })
+
+	l.SetLimit(2)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	if got := l.InUse(); got != 2 {
+		t.Fatalf("InUse() = %d, want 2", got)
+	}
+}
+
+// spinLimiter is the implementation Limiter replaced, kept to benchmark
+// against: it polls the count, releasing and retaking the mutex, until a
+// slot frees up.
+type spinLimiter struct {
+	limit int
+	count int
+	mu    sync.Mutex
+}
+
+func (l *spinLimiter) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.count >= l.limit {
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			return ctx.Err()
+		default:
+			l.mu.Lock()
+		}
+	}
+	l.count++
+	return nil
+}
+
+func (l *spinLimiter) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count <= 0 {
+		return errors.New("release called more times than acquire")
+	}
+	l.count--
+	return nil
+}
+
+// chanLimiter is the plain buffered-channel semaphore, the usual lightweight
+// alternative without weights or introspection.
+type chanLimiter chan struct{}
+
+func (l chanLimiter) Acquire(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l chanLimiter) Release() error {
+	<-l
+	return nil
+}
+
+type semaphore interface {
+	Acquire(ctx context.Context) error
+	Release() error
+}
+
+func benchmarkSemaphore(b *testing.B, s semaphore) {
+	ctx := context.Background()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := s.Acquire(ctx); err != nil {
+				b.Error(err)
+				return
+			}
+			// a little work while holding the slot so that callers contend
+			for i := 0; i < 100; i++ {
+				_ = i * i
+			}
+			if err := s.Release(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkAcquireRelease(b *testing.B) {
+	for _, limit := range []int{1, 4, 64} {
+		b.Run("limiter/"+strconv.Itoa(limit), func(b *testing.B) {
+			benchmarkSemaphore(b, NewLimiter(limit))
+		})
+		b.Run("spin/"+strconv.Itoa(limit), func(b *testing.B) {
+			benchmarkSemaphore(b, &spinLimiter{limit: limit})
+		})
+		b.Run("chan/"+strconv.Itoa(limit), func(b *testing.B) {
+			benchmarkSemaphore(b, make(chanLimiter, limit))
+		})
+	}
+}
+
+func BenchmarkAcquireNRelease(b *testing.B) {
+	l := NewLimiter(16)
+	ctx := context.Background()
+	b.RunParallel(func(pb *testing.PB) {
+		n := 1
+		for pb.Next() {
+			if err := l.AcquireN(ctx, n); err != nil {
+				b.Error(err)
+				return
+			}
+			if err := l.ReleaseN(n); err != nil {
+				b.Error(err)
+				return
+			}
+			n = n%8 + 1
+		}
+	})
+}
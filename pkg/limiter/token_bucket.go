@@ -0,0 +1,113 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket refills at rate tokens per second up to burst tokens.
+// A non-positive rate disables limiting.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return newTokenBucket(rate, burst, time.Now)
+}
+
+// newTokenBucket returns a full bucket that reads the time from now.
+func newTokenBucket(rate float64, burst int, now func() time.Time) *TokenBucket {
+	b := &TokenBucket{now: now}
+	b.last = b.now()
+	b.SetRate(rate, burst)
+	b.tokens = b.burst
+	return b
+}
+
+// SetRate changes the refill rate and capacity. Tokens accumulated so far
+// are kept, up to the new capacity.
+func (b *TokenBucket) SetRate(rate float64, burst int) {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.rate = rate
+	b.burst = float64(burst)
+	b.tokens = math.Min(b.tokens, b.burst)
+}
+
+func (b *TokenBucket) Allow() (bool, time.Duration) {
+	return b.AllowN(1)
+}
+
+// AllowN takes n tokens if they are available. Otherwise it reports how long
+// the caller should wait before the tokens could be available.
+func (b *TokenBucket) AllowN(n int) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return true, 0
+	}
+	b.refill()
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		return true, 0
+	}
+	missing := float64(n) - b.tokens
+	return false, time.Duration(missing / b.rate * float64(time.Second))
+}
+
+// WaitN takes n tokens, blocking until the bucket has paid them back.
+// n may exceed the burst size; the bucket then goes into debt and later
+// callers wait for it to be repaid.
+func (b *TokenBucket) WaitN(ctx context.Context, n int) error {
+	b.mu.Lock()
+	if b.rate <= 0 || n <= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.refill()
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens = math.Min(b.burst, b.tokens+float64(n))
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (b *TokenBucket) refill() {
+	now := b.now()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+}
@@ -0,0 +1,91 @@
+package limiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a time source that only moves when the test advances it.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	clock := newFakeClock()
+	b := newTokenBucket(10, 3, clock.now)
+
+	for i := range 3 {
+		if ok, _ := b.Allow(); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	ok, wait := b.Allow()
+	if ok {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if wait != 100*time.Millisecond {
+		t.Fatalf("wait = %s, want 100ms", wait)
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	clock := newFakeClock()
+	b := newTokenBucket(10, 5, clock.now)
+	if ok, _ := b.AllowN(5); !ok {
+		t.Fatal("AllowN(5) on a full bucket was refused")
+	}
+
+	clock.advance(250 * time.Millisecond)
+	if ok, _ := b.AllowN(2); !ok {
+		t.Fatal("AllowN(2) refused after 2.5 tokens were refilled")
+	}
+	if ok, wait := b.AllowN(1); ok || wait != 50*time.Millisecond {
+		t.Fatalf("AllowN(1) = %v, %s, want false, 50ms", ok, wait)
+	}
+
+	// a long pause refills up to the burst, not beyond it
+	clock.advance(time.Hour)
+	if ok, _ := b.AllowN(5); !ok {
+		t.Fatal("AllowN(5) refused after a long pause")
+	}
+	if ok, _ := b.Allow(); ok {
+		t.Fatal("bucket held more than its burst")
+	}
+}
+
+func TestTokenBucketUnlimited(t *testing.T) {
+	b := newTokenBucket(0, 0, newFakeClock().now)
+	for range 100 {
+		if ok, _ := b.Allow(); !ok {
+			t.Fatal("bucket with a zero rate refused a request")
+		}
+	}
+}
+
+func TestTokenBucketDefaultBurst(t *testing.T) {
+	b := newTokenBucket(2.5, 0, newFakeClock().now)
+	if ok, _ := b.AllowN(3); !ok {
+		t.Fatal("burst did not default to the rate rounded up")
+	}
+	if ok, _ := b.Allow(); ok {
+		t.Fatal("bucket allowed more than the default burst")
+	}
+}